@@ -59,16 +59,18 @@ func Compile(circuit frontend.Circuit, curve ecc.ID, setupConfig setup.Name) (
 }
 
 // WritePuyaPyVerifier writes to file python code that the PuyaPy compiler can
-// compile to a logicsig or smart contract verifier for the circuit.
+// compile to a logicsig or smart contract verifier, or a verifier subroutine or
+// logicsig verifier companion module, for the circuit.
+// Options can be passed to customize the generated verifier.
 func (cc *CompiledCircuit) WritePuyaPyVerifier(filepath string,
-	outputType verifier.ContractType) error {
+	outputType verifier.ContractType, opts ...verifier.Option) error {
 	file, err := os.Create(filepath)
 	if err != nil {
 		return fmt.Errorf("error creating file: %v", err)
 	}
 	defer file.Close()
 
-	err = verifier.WritePythonCode(cc.Vk, outputType, file)
+	err = verifier.WritePythonCode(cc.Vk, outputType, file, opts...)
 	if err != nil {
 		err = fmt.Errorf("error writing PuyaPy contract: %v", err)
 	}
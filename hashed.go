@@ -0,0 +1,102 @@
+package algoplonk
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr_bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	mimc_bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381/fr/mimc"
+	fr_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	mimc_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/mimc"
+)
+
+// HashedCircuit is a circuit whose public values are hashed into the only
+// public input of HashedPublicInputs. Its fields must all be secret, that is
+// without the `gnark:",public"` tag.
+type HashedCircuit interface {
+	frontend.Circuit
+	// PublicValues returns the values to hash, in the order the verifiers
+	// receive them as public inputs
+	PublicValues() []frontend.Variable
+}
+
+// HashedPublicInputs wraps Circuit to expose a single public input, Digest,
+// the MiMC hash of the values returned by Circuit.PublicValues, which the AVM
+// computes with the mimc opcode. The verifier cost and the size of the public
+// inputs then stay constant however many public values the circuit has.
+// Verifiers for it must be generated with verifier.WithHashedPublicInputs.
+type HashedPublicInputs struct {
+	Digest  frontend.Variable `gnark:",public"`
+	Circuit HashedCircuit
+}
+
+// Define defines the wrapped circuit and constrains Digest to be the MiMC hash
+// of its public values
+func (c *HashedPublicInputs) Define(api frontend.API) error {
+	if err := c.Circuit.Define(api); err != nil {
+		return err
+	}
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return fmt.Errorf("error creating MiMC hash: %v", err)
+	}
+	h.Write(c.Circuit.PublicValues()...)
+	api.AssertIsEqual(c.Digest, h.Sum())
+	return nil
+}
+
+// SetDigest sets Digest to the MiMC hash of the public values of the wrapped
+// circuit assignment, for proofs on `curve`
+func (c *HashedPublicInputs) SetDigest(curve ecc.ID) error {
+	values, err := c.MarshalPublicValues(curve)
+	if err != nil {
+		return err
+	}
+	var h hash.Hash
+	switch curve {
+	case ecc.BN254:
+		h = mimc_bn254.NewMiMC()
+	case ecc.BLS12_381:
+		h = mimc_bls12381.NewMiMC()
+	default:
+		return errors.New("unsupported curve")
+	}
+	if _, err := h.Write(values); err != nil {
+		return fmt.Errorf("error hashing public values: %v", err)
+	}
+	c.Digest = new(big.Int).SetBytes(h.Sum(nil))
+	return nil
+}
+
+// MarshalPublicValues marshals the public values of the wrapped circuit
+// assignment, for proofs on `curve`, to a binary blob that can be passed to
+// AVM verifiers generated with verifier.WithHashedPublicInputs as public inputs
+func (c *HashedPublicInputs) MarshalPublicValues(curve ecc.ID) ([]byte, error) {
+	var data []byte
+	for i, v := range c.Circuit.PublicValues() {
+		var b [32]byte
+		var err error
+		switch curve {
+		case ecc.BN254:
+			var x fr_bn254.Element
+			_, err = x.SetInterface(v)
+			b = x.Bytes()
+		case ecc.BLS12_381:
+			var x fr_bls12381.Element
+			_, err = x.SetInterface(v)
+			b = x.Bytes()
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading public value %d: %v", i, err)
+		}
+		data = append(data, b[:]...)
+	}
+	return data, nil
+}
@@ -0,0 +1,61 @@
+package algoplonk_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	ap "github.com/giuliop/algoplonk"
+	"github.com/giuliop/algoplonk/setup"
+)
+
+type hashedTestCircuit struct {
+	A, B, X frontend.Variable
+}
+
+func (c *hashedTestCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.B, api.Mul(c.A, c.X))
+	return nil
+}
+
+func (c *hashedTestCircuit) PublicValues() []frontend.Variable {
+	return []frontend.Variable{c.A, c.B}
+}
+
+func TestHashedPublicInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			cc, err := ap.Compile(&ap.HashedPublicInputs{Circuit: &hashedTestCircuit{}},
+				curve, setup.TestOnlySetup(curve))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nb := cc.Ccs.GetNbPublicVariables(); nb != 1 {
+				t.Fatalf("expected the digest as only public input, got %d", nb)
+			}
+
+			assignment := &ap.HashedPublicInputs{
+				Circuit: &hashedTestCircuit{A: 3, B: 12, X: 4}}
+			if err := assignment.SetDigest(curve); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cc.Verify(assignment); err != nil {
+				t.Fatalf("error verifying proof: %v", err)
+			}
+			values, err := assignment.MarshalPublicValues(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(values) != 2*32 || values[31] != 3 || values[63] != 12 {
+				t.Errorf("unexpected public values %x", values)
+			}
+
+			assignment.Digest = new(big.Int).Add(assignment.Digest.(*big.Int),
+				big.NewInt(1))
+			if _, err := cc.Verify(assignment); err == nil {
+				t.Errorf("expected error for wrong digest")
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/algorand/go-algorand-sdk/v2/abi"
 	"github.com/algorand/go-algorand-sdk/v2/client/v2/common/models"
 	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/algorand/go-algorand-sdk/v2/logic"
 	"github.com/algorand/go-algorand-sdk/v2/transaction"
 	"github.com/algorand/go-algorand-sdk/v2/types"
 )
@@ -41,6 +42,17 @@ func abiEncodeString(s string) ([]byte, error) {
 // A local network must be running
 func DeployArc4AppIfNeeded(appName string, dir string) (
 	appId uint64, err error) {
+	return DeployArc4AppWithCreateArgsIfNeeded(appName, dir)
+}
+
+// DeployArc4AppWithCreateArgsIfNeeded works like DeployArc4AppIfNeeded, but
+// passes `createArgs`, already ABI encoded, to the create method after the app
+// name, e.g., the initial state root of a verifier generated with
+// verifier.WithStateRoot. An app found up to date is not created again, so it
+// keeps the arguments it was created with.
+// A local network must be running
+func DeployArc4AppWithCreateArgsIfNeeded(appName string, dir string,
+	createArgs ...[]byte) (appId uint64, err error) {
 
 	algodClient := GetAlgodClient()
 
@@ -126,7 +138,7 @@ func DeployArc4AppIfNeeded(appName string, dir string) (
 			NumByteSlice: schema.State.Schema.Global.Bytes},
 		types.StateSchema{NumUint: schema.State.Schema.Local.Ints,
 			NumByteSlice: schema.State.Schema.Local.Bytes},
-		[][]byte{createMethod.GetSelector(), encodedAppName},
+		append([][]byte{createMethod.GetSelector(), encodedAppName}, createArgs...),
 		nil, nil, nil,
 		sp, creator.Address, nil,
 		types.Digest{}, [32]byte{}, types.ZeroAddress, extraPages,
@@ -505,6 +517,31 @@ func LogicSigFromFile(filename string) (*crypto.LogicSigAccount, error) {
 	}, nil
 }
 
+// CompileTealWithSourceMap compiles a teal program and returns its binary and
+// source map, mapping program counters to the lines of `teal`.
+// A local network must be running
+func CompileTealWithSourceMap(teal []byte) (
+	binary []byte, sourceMap logic.SourceMap, err error) {
+	algod := GetAlgodClient()
+	result, err := algod.TealCompile(teal).Sourcemap(true).Do(context.Background())
+	if err != nil {
+		return nil, sourceMap, fmt.Errorf("failed to compile program: %v", err)
+	}
+	binary, err = base64.StdEncoding.DecodeString(result.Result)
+	if err != nil {
+		return nil, sourceMap, fmt.Errorf("failed to decode compiled program: %v",
+			err)
+	}
+	if result.Sourcemap == nil {
+		return nil, sourceMap, fmt.Errorf("no source map returned")
+	}
+	sourceMap, err = logic.DecodeSourceMap(*result.Sourcemap)
+	if err != nil {
+		return nil, sourceMap, fmt.Errorf("failed to decode source map: %v", err)
+	}
+	return binary, sourceMap, nil
+}
+
 // AddDummyTrasactions adds numberOfTxnToAdd dummy transactions to atc.
 // The last transaction will have a fee of 1 algo to cover the fee for the group.
 // A local network must be running with default parameters
@@ -542,7 +579,8 @@ func AddDummyTrasactions(atc *transaction.AtomicTransactionComposer,
 }
 
 // ExecuteGroup executes a transaction group composed by atc.
-// If simulate is true, it simulates the group instead of sending it.
+// If simulate is true, it simulates the group instead of sending it, returning
+// only the method results.
 // A local network must be running with default parameters
 func ExecuteGroup(atc *transaction.AtomicTransactionComposer, simulate bool,
 ) (*transaction.ExecuteResult, error) {
@@ -563,7 +601,7 @@ func ExecuteGroup(atc *transaction.AtomicTransactionComposer, simulate bool,
 		lsigBudgetConsumed := simRes.SimulateResponse.TxnGroups[0].TxnResults[0].LogicSigBudgetConsumed
 		fmt.Println("LogicSig budget consumed: ", lsigBudgetConsumed)
 
-		return nil, nil
+		return &transaction.ExecuteResult{MethodResults: simRes.MethodResults}, nil
 	}
 	res, err := atc.Execute(algod, context.Background(), 4)
 	if err != nil {
@@ -571,3 +609,23 @@ func ExecuteGroup(atc *transaction.AtomicTransactionComposer, simulate bool,
 	}
 	return &res, nil
 }
+
+// SimulateGroup simulates the transaction group composed by atc, granting it
+// extraOpcodeBudget app opcode budget on top of the budget of its app calls,
+// and returns its method results and the app opcode budget it consumed.
+// A local network must be running with default parameters
+func SimulateGroup(atc *transaction.AtomicTransactionComposer,
+	extraOpcodeBudget uint64,
+) (results []transaction.ABIMethodResult, appBudgetConsumed uint64, err error) {
+	algod := GetAlgodClient()
+	simReq := models.SimulateRequest{ExtraOpcodeBudget: extraOpcodeBudget}
+	simRes, err := atc.Simulate(context.Background(), algod, simReq)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to simulate group: %v", err)
+	}
+	group := simRes.SimulateResponse.TxnGroups[0]
+	if group.FailureMessage != "" {
+		return nil, 0, fmt.Errorf("transaction failed: %s", group.FailureMessage)
+	}
+	return simRes.MethodResults, group.AppBudgetConsumed, nil
+}
@@ -152,9 +152,10 @@ func TestSmartContractVerifierWithCommitment(t *testing.T) {
 	}
 }
 
-// TestSmartContractVerifierWithTwoCommitments measures the verifier budget
-// overhead of an additional BSB22 commitment. In local simulation this reports
-// about 35,000 extra app opcode budget for BN254 and 40,000 for BLS12-381.
+// TestSmartContractVerifierWithTwoCommitments tests the verifier smart
+// contract for a circuit with two BSB22 commitment gates, for both BN254 and
+// BLS12_381 curves. TestSmartContractVerifierOpcodeBudget checks the budget
+// overhead of each commitment against the README table.
 func TestSmartContractVerifierWithTwoCommitments(t *testing.T) {
 	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
 		t.Run(curve.String(), func(t *testing.T) {
@@ -0,0 +1,280 @@
+package testutils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/algorand/go-algorand-sdk/v2/transaction"
+	"github.com/algorand/go-algorand-sdk/v2/types"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	sdk "github.com/giuliop/algoplonk/testutils/algosdkwrapper"
+	"github.com/giuliop/algoplonk/utils"
+	"github.com/giuliop/algoplonk/verifier"
+)
+
+// BudgetCircuit proves the knowledge of the square root of its public input
+// with nbCommitments BSB22 commitments, possibly none, to measure how the
+// opcode budget of its verifiers grows with them
+type BudgetCircuit struct {
+	Public frontend.Variable `gnark:",public"`
+	Secret frontend.Variable
+
+	nbCommitments int
+}
+
+func (c *BudgetCircuit) Define(api frontend.API) error {
+	toCommit := c.Secret
+	for range c.nbCommitments {
+		committer, ok := api.(frontend.Committer)
+		if !ok {
+			return fmt.Errorf("compiler does not support Commit")
+		}
+		cmt, err := committer.Commit(toCommit, c.Public)
+		if err != nil {
+			return err
+		}
+		api.AssertIsDifferent(cmt, 0)
+		toCommit = cmt
+	}
+	api.AssertIsEqual(c.Public, api.Mul(c.Secret, c.Secret))
+	return nil
+}
+
+// readmeOpcodeBudget is the opcode budget of the smart contract verifiers of a
+// circuit with one public input in the README table, by curve and number of
+// BSB22 commitments, which must be updated together
+var readmeOpcodeBudget = map[ecc.ID][3]uint64{
+	ecc.BN254:     {93_000, 105_000, 120_000},
+	ecc.BLS12_381: {120_000, 136_000, 153_000},
+}
+
+// TestSmartContractVerifierOpcodeBudget measures by simulation the opcode
+// budget smart contract verifiers consume, for both curves and up to two BSB22
+// commitments, and checks that it matches the README table within 5%
+func TestSmartContractVerifierOpcodeBudget(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		for nbCommitments := range 3 {
+			t.Run(fmt.Sprintf("%s/%d", curve, nbCommitments), func(t *testing.T) {
+				verifierName := fmt.Sprintf(
+					"VerifierSmartContractBudget%dForCurve%s", nbCommitments, curve)
+				compiledCircuit := buildCircuitVerifier(t, curve,
+					&BudgetCircuit{nbCommitments: nbCommitments}, verifierName,
+					verifier.SmartContract)
+				proof, publicInputs := proveAssignment(t, compiledCircuit,
+					&BudgetCircuit{Public: 9, Secret: 3})
+				appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+				if err != nil {
+					t.Fatalf("error deploying verifier app to local network: %v", err)
+				}
+				schema := readSchema(t, verifierName)
+
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+					publicInputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				txnParams, err := sdk.BuildMethodCallParams(appId, schema, "verify",
+					types.NoOpOC, args, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var atc = transaction.AtomicTransactionComposer{}
+				if err := atc.AddMethodCall(*txnParams); err != nil {
+					t.Fatal(err)
+				}
+				results, consumed, err := sdk.SimulateGroup(&atc, 320_000)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if results[0].ReturnValue != true {
+					t.Fatal("verifier app did not verify the proof")
+				}
+				want := readmeOpcodeBudget[curve][nbCommitments]
+				t.Logf("opcode budget consumed: %d, README: %d", consumed, want)
+				if consumed*100 < want*95 || consumed*100 > want*105 {
+					t.Fatalf("consumed %d opcode budget, the README reports %d",
+						consumed, want)
+				}
+			})
+		}
+	}
+}
+
+// TestSmartContractVerifierWithOpUp tests that a smart contract verifier
+// generated with verifier.WithOpUp verifies a proof with a single app call,
+// paying verifier.OpUpFee and with no extra opcode budget, for both curves
+// and up to two BSB22 commitments, and that the budget it consumes is within
+// verifier.EstimateOpcodeBudget. The verifiers with one commitment also check
+// failure reasons, and those with two spend a nullifier and emit the verified
+// event, whose budget the estimate covers.
+func TestSmartContractVerifierWithOpUp(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		for nbCommitments := range 3 {
+			t.Run(fmt.Sprintf("%s/%d", curve, nbCommitments), func(t *testing.T) {
+				opts := []verifier.Option{verifier.WithOpUp()}
+				if nbCommitments == 1 {
+					opts = append(opts, verifier.WithFailureReasons())
+				}
+				if nbCommitments == 2 {
+					opts = append(opts, verifier.WithNullifier(0),
+						verifier.WithVerifiedEvent(true))
+				}
+				verifierName := fmt.Sprintf(
+					"VerifierSmartContractWithOpUp%dForCurve%s", nbCommitments, curve)
+				compiledCircuit := buildCircuitVerifier(t, curve,
+					&BudgetCircuit{nbCommitments: nbCommitments}, verifierName,
+					verifier.SmartContract, opts...)
+				proof, publicInputs := proveAssignment(t, compiledCircuit,
+					&BudgetCircuit{Public: 9, Secret: 3})
+				appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+				if err != nil {
+					t.Fatalf("error deploying verifier app to local network: %v", err)
+				}
+				schema := readSchema(t, verifierName)
+				vk := compiledCircuit.Vk
+				// the app account sends the inner app calls
+				sdk.EnsureFunded(crypto.GetApplicationAddress(appId).String(),
+					1_000_000)
+
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+					publicInputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				boxes := []types.AppBoxReference{{AppID: appId,
+					Name: append([]byte("n"), publicInputs[:32]...)}}
+				txnParams, err := sdk.BuildMethodCallParams(appId, schema, "verify",
+					types.NoOpOC, args, boxes, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var atc = transaction.AtomicTransactionComposer{}
+				if nbCommitments == 2 {
+					// the payment preceding the verify call pays for the
+					// nullifier box
+					deposit, err := transaction.MakePaymentTxn(
+						txnParams.Sender.String(),
+						crypto.GetApplicationAddress(appId).String(),
+						utils.NullifierDeposit, nil, types.ZeroAddress.String(),
+						txnParams.SuggestedParams)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := atc.AddTransaction(transaction.TransactionWithSigner{
+						Txn: deposit, Signer: txnParams.Signer}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				fee, err := verifier.OpUpFee(vk, txnParams.SuggestedParams.MinFee,
+					opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				txnParams.SuggestedParams.FlatFee = true
+				txnParams.SuggestedParams.Fee = types.MicroAlgos(fee)
+
+				if err := atc.AddMethodCall(*txnParams); err != nil {
+					t.Fatal(err)
+				}
+				results, consumed, err := sdk.SimulateGroup(&atc, 0)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if results[0].ReturnValue != true {
+					t.Fatal("verifier app did not verify the proof")
+				}
+				estimate, err := verifier.EstimateOpcodeBudget(vk, opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Logf("opcode budget consumed: %d, estimate: %d", consumed, estimate)
+				if consumed > uint64(estimate) {
+					t.Fatalf("consumed %d opcode budget, above the estimate %d",
+						consumed, estimate)
+				}
+			})
+		}
+	}
+}
+
+// TestSmartContractVerifierWithSubgroupChecks tests that a smart contract
+// verifier generated with verifier.WithSubgroupChecks verifies a valid proof,
+// for both curves and up to one BSB22 commitment, whose point is checked too,
+// and that the budget it consumes, with the checks, is within
+// verifier.EstimateOpcodeBudget
+func TestSmartContractVerifierWithSubgroupChecks(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		for nbCommitments := range 2 {
+			t.Run(fmt.Sprintf("%s/%d", curve, nbCommitments), func(t *testing.T) {
+				opts := []verifier.Option{verifier.WithSubgroupChecks()}
+				verifierName := fmt.Sprintf(
+					"VerifierSmartContractWithSubgroupChecks%dForCurve%s",
+					nbCommitments, curve)
+				compiledCircuit := buildCircuitVerifier(t, curve,
+					&BudgetCircuit{nbCommitments: nbCommitments}, verifierName,
+					verifier.SmartContract, opts...)
+				proof, publicInputs := proveAssignment(t, compiledCircuit,
+					&BudgetCircuit{Public: 9, Secret: 3})
+				appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+				if err != nil {
+					t.Fatalf("error deploying verifier app to local network: %v", err)
+				}
+				schema := readSchema(t, verifierName)
+				vk := compiledCircuit.Vk
+
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+					publicInputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				txnParams, err := sdk.BuildMethodCallParams(appId, schema, "verify",
+					types.NoOpOC, args, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var atc = transaction.AtomicTransactionComposer{}
+				if err := atc.AddMethodCall(*txnParams); err != nil {
+					t.Fatal(err)
+				}
+				results, consumed, err := sdk.SimulateGroup(&atc, 320_000)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if results[0].ReturnValue != true {
+					t.Fatal("verifier app did not verify the proof")
+				}
+				estimate, err := verifier.EstimateOpcodeBudget(vk, opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Logf("opcode budget consumed: %d, estimate: %d", consumed, estimate)
+				if consumed > uint64(estimate) {
+					t.Fatalf("consumed %d opcode budget, above the estimate %d",
+						consumed, estimate)
+				}
+			})
+		}
+	}
+}
+
+// TestLogicSigVerifierWithSubgroupChecks tests that a logicsig verifier
+// generated with verifier.WithSubgroupChecks verifies a valid proof within the
+// opcode budget pooled by a group of 16 transactions, for both curves
+func TestLogicSigVerifierWithSubgroupChecks(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			testCase := buildLogicsigVerifierTestCase(t, curve,
+				"VerifierLogicSigWithSubgroupChecks", verifier.WithSubgroupChecks())
+			simulate := true
+
+			err := CallLogicSigVerifier(testCase.testAppId, testCase.testAppSchema,
+				testCase.verifierLogicSig, testCase.proof, testCase.publicInputs,
+				simulate)
+			if err != nil {
+				t.Fatalf("error calling logicsig verifier: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+package testutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/algorand/go-algorand-sdk/v2/transaction"
+	"github.com/algorand/go-algorand-sdk/v2/types"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	ap "github.com/giuliop/algoplonk"
+	"github.com/giuliop/algoplonk/setup"
+	sdk "github.com/giuliop/algoplonk/testutils/algosdkwrapper"
+	"github.com/giuliop/algoplonk/utils"
+	"github.com/giuliop/algoplonk/verifier"
+)
+
+// buildCircuitVerifier compiles `circuit` and generates and compiles a
+// verifier of type `verifierType` for it, named `verifierName`, generated
+// with `opts`, returning the compiled circuit to prove assignments with
+func buildCircuitVerifier(t *testing.T, curve ecc.ID, circuit frontend.Circuit,
+	verifierName string, verifierType verifier.ContractType,
+	opts ...verifier.Option,
+) *ap.CompiledCircuit {
+	t.Helper()
+
+	compiledCircuit, err := ap.Compile(circuit, curve, setup.TestOnlySetup(curve))
+	if err != nil {
+		t.Fatalf("\nerror compiling circuit: %v", err)
+	}
+	puyaVerifierFilename := filepath.Join(artefactsFolder, verifierName+".py")
+	err = compiledCircuit.WritePuyaPyVerifier(puyaVerifierFilename,
+		verifierType, opts...)
+	if err != nil {
+		t.Fatalf("error writing PuyaPy verifier: %v", err)
+	}
+	err = utils.CompileWithPuyaPy(puyaVerifierFilename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = utils.RenamePuyaPyOutput(verifier.DefaultFileName, verifierName,
+		artefactsFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiledCircuit
+}
+
+// proveAssignment returns the proof and public inputs of `assignment` of
+// `compiledCircuit`, as exported by AlgoPlonk
+func proveAssignment(t *testing.T, compiledCircuit *ap.CompiledCircuit,
+	assignment frontend.Circuit) (proof []byte, publicInputs []byte) {
+	t.Helper()
+
+	verifiedProof, err := compiledCircuit.Verify(assignment)
+	if err != nil {
+		t.Fatalf("\nerror during verification: %v", err)
+	}
+	var proofBuf, publicInputsBuf bytes.Buffer
+	if err := verifiedProof.WriteProof(&proofBuf); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifiedProof.WritePublicInputs(&publicInputsBuf); err != nil {
+		t.Fatal(err)
+	}
+	return proofBuf.Bytes(), publicInputsBuf.Bytes()
+}
+
+// readSchema returns the ARC-56 schema of the app compiled as `verifierName`
+func readSchema(t *testing.T, verifierName string) *sdk.Arc56Schema {
+	t.Helper()
+
+	schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+		verifierName+".arc56.json"))
+	if err != nil {
+		t.Fatalf("failed to read application schema: %s", err)
+	}
+	return schema
+}
+
+// StateTransitionCircuit proves a transition from OldRoot to NewRoot, adding
+// the square of a secret to it
+type StateTransitionCircuit struct {
+	OldRoot frontend.Variable `gnark:",public"`
+	NewRoot frontend.Variable `gnark:",public"`
+	Secret  frontend.Variable
+}
+
+func (c *StateTransitionCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.NewRoot, api.Add(c.OldRoot, api.Mul(c.Secret, c.Secret)))
+	return nil
+}
+
+// TestSmartContractVerifierWithStateRoot tests that a smart contract verifier
+// generated with verifier.WithStateRoot verifies a proof of a transition from
+// the state root it was created with, moving to the new root, and then rejects
+// the same proof, which no longer starts from the current root
+func TestSmartContractVerifierWithStateRoot(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			verifierName := "VerifierSmartContractWithStateRootForCurve" +
+				curve.String()
+			compiledCircuit := buildCircuitVerifier(t, curve,
+				&StateTransitionCircuit{}, verifierName, verifier.SmartContract,
+				verifier.WithStateRoot(0, 1))
+			proof, publicInputs := proveAssignment(t, compiledCircuit,
+				&StateTransitionCircuit{OldRoot: 1, NewRoot: 10, Secret: 3})
+
+			appId, err := sdk.DeployArc4AppWithCreateArgsIfNeeded(verifierName,
+				artefactsFolder, publicInputs[:32])
+			if err != nil {
+				t.Fatalf("error deploying verifier app to local network: %v", err)
+			}
+			schema := readSchema(t, verifierName)
+
+			args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+				publicInputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var atc = transaction.AtomicTransactionComposer{}
+			for i := range 2 {
+				txnParams, err := sdk.BuildMethodCallParams(appId, schema, "verify",
+					types.NoOpOC, args, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				txnParams.Note = []byte{byte(i)}
+				if err := atc.AddMethodCall(*txnParams); err != nil {
+					t.Fatal(err)
+				}
+			}
+			results, _, err := sdk.SimulateGroup(&atc, 320_000)
+			if err != nil {
+				t.Fatalf("error calling verifier app: %v", err)
+			}
+			if results[0].ReturnValue != true {
+				t.Fatal("verifier app did not verify the state transition")
+			}
+			if results[1].ReturnValue != false {
+				t.Fatal("verifier app verified a transition from a stale root")
+			}
+		})
+	}
+}
+
+// PaymentCircuit authorizes a payment of Amount, a square, to the address
+// whose high and low 128 bits are ReceiverHi and ReceiverLo
+type PaymentCircuit struct {
+	ReceiverHi frontend.Variable `gnark:",public"`
+	ReceiverLo frontend.Variable `gnark:",public"`
+	Amount     frontend.Variable `gnark:",public"`
+	Secret     frontend.Variable
+}
+
+func (c *PaymentCircuit) Define(api frontend.API) error {
+	api.AssertIsDifferent(c.ReceiverLo, 0)
+	api.AssertIsEqual(c.Amount, api.Mul(c.Secret, c.Secret))
+	return nil
+}
+
+// TestEscrowLogicSigVerifierWithTxnBinding tests that an escrow logicsig
+// verifier generated with verifier.WithTxnBinding signs the payment its proof
+// is bound to, and rejects a payment with another amount or receiver, including
+// the receiver equal to the bound one modulo the curve order
+func TestEscrowLogicSigVerifierWithTxnBinding(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			verifierName := "VerifierEscrowLogicSigWithTxnBindingForCurve" +
+				curve.String()
+			compiledCircuit := buildCircuitVerifier(t, curve, &PaymentCircuit{},
+				verifierName, verifier.LogicSig, verifier.WithEscrow(),
+				verifier.WithTxnBinding(verifier.TxnReceiver, 0),
+				verifier.WithTxnBinding(verifier.TxnAmount, 2),
+				verifier.WithFailureReasons())
+			tealFile := filepath.Join(artefactsFolder, verifierName+".teal")
+			escrow, err := sdk.LogicSigFromFile(tealFile)
+			if err != nil {
+				t.Fatalf("error reading escrow logicsig: %v", err)
+			}
+
+			account, err := sdk.GetDefaultAccount()
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiverHi, receiverLo := utils.FieldElementsFromAddress(account.Address)
+			proof, publicInputs := proveAssignment(t, compiledCircuit,
+				&PaymentCircuit{
+					ReceiverHi: receiverHi,
+					ReceiverLo: receiverLo,
+					Amount:     utils.FieldElementFromUint64(10_000),
+					Secret:     100,
+				})
+			simulate := true
+
+			cases := []struct {
+				name   string
+				edit   func(txn *types.Transaction)
+				reason verifier.FailureReason
+			}{
+				{"bound payment", func(txn *types.Transaction) {
+					txn.Amount = 10_000
+				}, verifier.Verified},
+				{"other amount", func(txn *types.Transaction) {
+					txn.Amount = 10_001
+				}, verifier.RejectedTransaction},
+				{"other receiver", func(txn *types.Transaction) {
+					txn.Amount = 10_000
+					txn.Receiver = escrowAddress(t, escrow)
+				}, verifier.RejectedTransaction},
+				{"receiver aliased modulo the curve order", func(txn *types.Transaction) {
+					txn.Amount = 10_000
+					txn.Receiver = aliasedAddress(account.Address, curve)
+				}, verifier.RejectedTransaction},
+			}
+			for _, c := range cases {
+				err := CallEscrowLogicSigVerifier(escrow, proof, publicInputs,
+					c.edit, simulate)
+				reason, err := LogicSigVerifierFailureReason(tealFile, err)
+				if err != nil {
+					t.Fatalf("error getting failure reason for %s: %v", c.name, err)
+				}
+				if reason != c.reason {
+					t.Fatalf("expected %s for %s, got %s", c.reason, c.name, reason)
+				}
+			}
+		})
+	}
+}
+
+// escrowAddress returns the address of the escrow logicsig `lsig`
+func escrowAddress(t *testing.T, lsig *crypto.LogicSigAccount) types.Address {
+	t.Helper()
+
+	address, err := lsig.Address()
+	if err != nil {
+		t.Fatalf("failed to get escrow address: %v", err)
+	}
+	return address
+}
+
+// aliasedAddress returns the address that is `address` plus the order of the
+// scalar field of `curve`, or minus it if the sum overflows 32 bytes, which a
+// field element reduced modulo the curve order cannot tell from `address`
+func aliasedAddress(address types.Address, curve ecc.ID) types.Address {
+	x := new(big.Int).SetBytes(address[:])
+	x.Add(x, curve.ScalarField())
+	if x.BitLen() > 256 {
+		x.Sub(x, curve.ScalarField())
+		x.Sub(x, curve.ScalarField())
+	}
+	var aliased types.Address
+	x.FillBytes(aliased[:])
+	return aliased
+}
+
+// DomainCircuit declares the public inputs that bind its proofs to a network
+// and an app
+type DomainCircuit struct {
+	GenesisHashHi frontend.Variable `gnark:",public"`
+	GenesisHashLo frontend.Variable `gnark:",public"`
+	AppID         frontend.Variable `gnark:",public"`
+}
+
+func (c *DomainCircuit) Define(api frontend.API) error {
+	api.AssertIsDifferent(c.GenesisHashHi, 0)
+	api.AssertIsDifferent(c.GenesisHashLo, 0)
+	api.AssertIsDifferent(c.AppID, 0)
+	return nil
+}
+
+// TestSmartContractVerifierWithDomainSeparation tests that a smart contract
+// verifier generated with verifier.WithDomainSeparation verifies a proof bound
+// to the local network and to its app, and rejects proofs bound to another
+// network or app
+func TestSmartContractVerifierWithDomainSeparation(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			verifierName := "VerifierSmartContractWithDomainSeparationForCurve" +
+				curve.String()
+			compiledCircuit := buildCircuitVerifier(t, curve, &DomainCircuit{},
+				verifierName, verifier.SmartContract,
+				verifier.WithDomainSeparation(0, 2))
+			appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+			if err != nil {
+				t.Fatalf("error deploying verifier app to local network: %v", err)
+			}
+			schema := readSchema(t, verifierName)
+
+			sp, err := sdk.GetAlgodClient().SuggestedParams().Do(
+				context.Background())
+			if err != nil {
+				t.Fatalf("failed to get suggested params: %v", err)
+			}
+			localnet, err := utils.NewNetwork("localnet", sp.GenesisHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cases := []struct {
+				name    string
+				network utils.Network
+				appId   uint64
+				want    bool
+			}{
+				{"bound proof", localnet, appId, true},
+				{"other network", utils.TestNet, appId, false},
+				{"other app", localnet, appId + 1, false},
+			}
+			simulate := true
+			for _, c := range cases {
+				hi, lo, appID := c.network.DomainPublicInputs(c.appId)
+				proof, publicInputs := proveAssignment(t, compiledCircuit,
+					&DomainCircuit{GenesisHashHi: hi, GenesisHashLo: lo, AppID: appID})
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+					publicInputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := sdk.ExecuteAbiCall(appId, schema, "verify",
+					types.NoOpOC, args, nil, nil, simulate)
+				if err != nil {
+					t.Fatalf("error calling verifier app for %s: %v", c.name, err)
+				}
+				if result.ReturnValue != c.want {
+					t.Fatalf("verifier app returned %v for %s, want %v",
+						result.ReturnValue, c.name, c.want)
+				}
+			}
+		})
+	}
+}
+
+// ProductCircuit proves that C is the product of A and B, all hashed into the
+// public input of algoplonk.HashedPublicInputs
+type ProductCircuit struct {
+	A, B, C frontend.Variable
+}
+
+func (c *ProductCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.C, api.Mul(c.A, c.B))
+	return nil
+}
+
+func (c *ProductCircuit) PublicValues() []frontend.Variable {
+	return []frontend.Variable{c.A, c.B, c.C}
+}
+
+// TestSmartContractVerifierWithHashedPublicInputs tests that a smart contract
+// verifier generated with verifier.WithHashedPublicInputs verifies a proof of
+// a circuit wrapped with algoplonk.HashedPublicInputs for its public values,
+// and rejects other public values
+func TestSmartContractVerifierWithHashedPublicInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			verifierName := "VerifierSmartContractWithHashedPublicInputsForCurve" +
+				curve.String()
+			compiledCircuit := buildCircuitVerifier(t, curve,
+				&ap.HashedPublicInputs{Circuit: &ProductCircuit{}}, verifierName,
+				verifier.SmartContract, verifier.WithHashedPublicInputs(3))
+			appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+			if err != nil {
+				t.Fatalf("error deploying verifier app to local network: %v", err)
+			}
+			schema := readSchema(t, verifierName)
+
+			assignment := &ap.HashedPublicInputs{
+				Circuit: &ProductCircuit{A: 3, B: 4, C: 12}}
+			if err := assignment.SetDigest(curve); err != nil {
+				t.Fatal(err)
+			}
+			proof, _ := proveAssignment(t, compiledCircuit, assignment)
+			publicValues, err := assignment.MarshalPublicValues(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherValues := append([]byte(nil), publicValues...)
+			otherValues[len(otherValues)-1] ^= 1
+
+			simulate := true
+			for _, c := range []struct {
+				name   string
+				values []byte
+				want   bool
+			}{
+				{"public values", publicValues, true},
+				{"other public values", otherValues, false},
+			} {
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+					c.values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := sdk.ExecuteAbiCall(appId, schema, "verify",
+					types.NoOpOC, args, nil, nil, simulate)
+				if err != nil {
+					t.Fatalf("error calling verifier app for %s: %v", c.name, err)
+				}
+				if result.ReturnValue != c.want {
+					t.Fatalf("verifier app returned %v for %s, want %v",
+						result.ReturnValue, c.name, c.want)
+				}
+			}
+		})
+	}
+}
+
+// TestLogicSigVerifierWithGroupArgs tests that a logicsig verifier generated
+// with verifier.WithGroupArgs reads the proof and public inputs from the app
+// call at the start of its group, ignoring the arguments of the app call it
+// signs
+func TestLogicSigVerifierWithGroupArgs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			testCase := buildLogicsigVerifierTestCase(t, curve,
+				"VerifierLogicSigWithGroupArgs", verifier.WithGroupArgs(0, 1, 2))
+			flippedPublicInputs := append([]byte(nil), testCase.publicInputs...)
+			flippedPublicInputs[31] ^= 1
+			simulate := true
+
+			err := callLogicSigVerifierWithGroupArgs(testCase, testCase.publicInputs,
+				flippedPublicInputs, simulate)
+			if err != nil {
+				t.Fatalf("error calling logicsig verifier: %v", err)
+			}
+			err = callLogicSigVerifierWithGroupArgs(testCase, flippedPublicInputs,
+				testCase.publicInputs, simulate)
+			if err == nil {
+				t.Fatal("Logicsig successful but was expected to fail")
+			}
+			if !strings.Contains(err.Error(), "rejected by logic") {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// callLogicSigVerifierWithGroupArgs makes a group whose first transaction is
+// an app call to the "verify" method of the test app with the proof and
+// `groupPublicInputs`, and whose second is the same call signed by the
+// logicsig verifier with the proof and `ownPublicInputs`, filled to 16
+// transactions to pool logicsig opcode budget
+func callLogicSigVerifierWithGroupArgs(testCase logicsigVerifierTestCase,
+	groupPublicInputs []byte, ownPublicInputs []byte, simulate bool) error {
+	var atc = transaction.AtomicTransactionComposer{}
+	signer := transaction.LogicSigAccountTransactionSigner{
+		LogicSigAccount: *testCase.verifierLogicSig}
+	for _, call := range []struct {
+		publicInputs []byte
+		signer       transaction.TransactionSigner
+	}{
+		{groupPublicInputs, nil},
+		{ownPublicInputs, signer},
+	} {
+		args, err := utils.ProofAndPublicInputsForAtomicComposer(testCase.proof,
+			call.publicInputs)
+		if err != nil {
+			return err
+		}
+		txnParams, err := sdk.BuildMethodCallParams(testCase.testAppId,
+			testCase.testAppSchema, "verify", types.NoOpOC, args, nil, call.signer)
+		if err != nil {
+			return err
+		}
+		txnParams.SuggestedParams.FlatFee = true
+		txnParams.SuggestedParams.Fee = 0
+		if err := atc.AddMethodCall(*txnParams); err != nil {
+			return err
+		}
+	}
+	if err := sdk.AddDummyTrasactions(&atc, 14); err != nil {
+		return err
+	}
+	_, err := sdk.ExecuteGroup(&atc, simulate)
+	return err
+}
+
+// TestVerifierWithAVMVersion tests that smart contract and logicsig verifiers
+// generated with verifier.WithAVMVersion, for each AVM version providing the
+// elliptic curve opcodes, up to version 12 whose bmodexp opcode they use,
+// compile and verify a valid proof, and that the smart contract verifiers
+// reject a proof with a flipped public input
+func TestVerifierWithAVMVersion(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		for _, version := range []int{10, 11, 12} {
+			t.Run(fmt.Sprintf("%s/%d", curve, version), func(t *testing.T) {
+				verifierName := fmt.Sprintf(
+					"VerifierSmartContractWithAVMVersion%dForCurve%s", version, curve)
+				compiledCircuit := buildCircuitVerifier(t, curve,
+					&BudgetCircuit{}, verifierName, verifier.SmartContract,
+					verifier.WithAVMVersion(version))
+				proof, publicInputs := proveAssignment(t, compiledCircuit,
+					&BudgetCircuit{Public: 9, Secret: 3})
+				appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+				if err != nil {
+					t.Fatalf("error deploying verifier app to local network: %v", err)
+				}
+				schema := readSchema(t, verifierName)
+				flippedPublicInputs := append([]byte(nil), publicInputs...)
+				flippedPublicInputs[31] ^= 1
+
+				simulate := true
+				for _, c := range []struct {
+					name         string
+					publicInputs []byte
+					want         bool
+				}{
+					{"valid proof", publicInputs, true},
+					{"flipped public input", flippedPublicInputs, false},
+				} {
+					args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+						c.publicInputs)
+					if err != nil {
+						t.Fatal(err)
+					}
+					result, err := sdk.ExecuteAbiCall(appId, schema, "verify",
+						types.NoOpOC, args, nil, nil, simulate)
+					if err != nil {
+						t.Fatalf("error calling verifier app for %s: %v", c.name, err)
+					}
+					if result.ReturnValue != c.want {
+						t.Fatalf("verifier app returned %v for %s, want %v",
+							result.ReturnValue, c.name, c.want)
+					}
+				}
+
+				testCase := buildLogicsigVerifierTestCase(t, curve,
+					fmt.Sprintf("VerifierLogicSigWithAVMVersion%d", version),
+					verifier.WithAVMVersion(version))
+				err = CallLogicSigVerifier(testCase.testAppId,
+					testCase.testAppSchema, testCase.verifierLogicSig, testCase.proof,
+					testCase.publicInputs, simulate)
+				if err != nil {
+					t.Fatalf("error calling logicsig verifier: %v", err)
+				}
+			})
+		}
+	}
+}
@@ -7,9 +7,11 @@
 package testutils
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/algorand/go-algorand-sdk/v2/crypto"
 	"github.com/algorand/go-algorand-sdk/v2/transaction"
@@ -18,6 +20,7 @@ import (
 	"github.com/giuliop/algoplonk/setup"
 	sdk "github.com/giuliop/algoplonk/testutils/algosdkwrapper"
 	"github.com/giuliop/algoplonk/utils"
+	"github.com/giuliop/algoplonk/verifier"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/plonk"
@@ -93,6 +96,224 @@ func CallVerifyMethod(appId uint64, proofFilename string, publicInputsFilename s
 	return sdk.ExecuteAbiCall(appId, schema, "verify", types.NoOpOC, args, nil, nil, simulate)
 }
 
+// CallVerifyUploadedMethod makes a transaction group with an app call to
+// appId's "start_upload" method, taking a payment of utils.UploadDeposit from
+// the default account, followed by app calls to its "upload" method, uploading
+// proof and public inputs to the upload box of the default account, and by an
+// app call to its "verify_uploaded" method, for verifiers generated with
+// verifier.WithBoxInputs. The group ends with a transaction paying the fee of
+// the inner payment refunding the deposit. It funds the app account to cover
+// its minimum balance.
+// If simulate is true, it simulates the group instead of sending it.
+// A local network must be running with default parameters
+func CallVerifyUploadedMethod(appId uint64, schema *sdk.Arc56Schema,
+	proof []byte, publicInputs []byte, simulate bool,
+) (*transaction.ABIMethodResult, error) {
+	uploads, err := utils.UploadMethodArgs(proof, publicInputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode proof and public inputs: %v", err)
+	}
+	account, err := sdk.GetDefaultAccount()
+	if err != nil {
+		return nil, err
+	}
+	boxes := utils.UploadBoxReferences(appId, account.Address, proof, publicInputs)
+	appAddress := crypto.GetApplicationAddress(appId)
+	sdk.EnsureFunded(appAddress.String(), 100_000)
+
+	sp, err := sdk.GetAlgodClient().SuggestedParams().Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggested params: %v", err)
+	}
+	deposit, err := transaction.MakePaymentTxn(account.Address.String(),
+		appAddress.String(), utils.UploadDeposit(proof, publicInputs), nil,
+		types.ZeroAddress.String(), sp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make payment txn: %v", err)
+	}
+	startArgs := []interface{}{transaction.TransactionWithSigner{
+		Txn:    deposit,
+		Signer: transaction.BasicAccountTransactionSigner{Account: *account},
+	}}
+
+	var atc = transaction.AtomicTransactionComposer{}
+	txnParams, err := sdk.BuildMethodCallParams(appId, schema, "start_upload",
+		types.NoOpOC, startArgs, boxes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build method call params: %v", err)
+	}
+	if err := atc.AddMethodCall(*txnParams); err != nil {
+		return nil, fmt.Errorf("failed to add method call: %v", err)
+	}
+	for _, args := range uploads {
+		txnParams, err := sdk.BuildMethodCallParams(appId, schema, "upload",
+			types.NoOpOC, args, boxes, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build method call params: %v", err)
+		}
+		if err := atc.AddMethodCall(*txnParams); err != nil {
+			return nil, fmt.Errorf("failed to add method call: %v", err)
+		}
+	}
+	txnParams, err = sdk.BuildMethodCallParams(appId, schema, "verify_uploaded",
+		types.NoOpOC, nil, boxes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build method call params: %v", err)
+	}
+	if err := atc.AddMethodCall(*txnParams); err != nil {
+		return nil, fmt.Errorf("failed to add method call: %v", err)
+	}
+	if err := sdk.AddDummyTrasactions(&atc, 1); err != nil {
+		return nil, err
+	}
+	res, err := sdk.ExecuteGroup(&atc, simulate)
+	if err != nil {
+		return nil, err
+	}
+	return &res.MethodResults[len(res.MethodResults)-1], nil
+}
+
+// CallResumableVerifyMethods makes a transaction group with an app call to
+// appId's "verify_start" method, taking a payment of utils.SessionDeposit from
+// the default account, followed by an app call to its "verify_finish" method
+// with the same proof and public inputs, for verifiers generated with
+// verifier.WithResumableVerification, and returns the results of the two
+// calls. The group ends with a transaction paying the fee of the inner payment
+// refunding the deposit. It funds the app account to cover its minimum
+// balance.
+// If simulate is true, it simulates the group instead of sending it.
+// A local network must be running with default parameters
+func CallResumableVerifyMethods(appId uint64, schema *sdk.Arc56Schema,
+	proof []byte, publicInputs []byte, simulate bool,
+) (start *transaction.ABIMethodResult, finish *transaction.ABIMethodResult,
+	err error) {
+
+	args, err := utils.ProofAndPublicInputsForAtomicComposer(proof, publicInputs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode proof and public inputs: %v",
+			err)
+	}
+	session, err := utils.SessionBoxName(proof, publicInputs)
+	if err != nil {
+		return nil, nil, err
+	}
+	boxes := []types.AppBoxReference{{AppID: appId, Name: session}}
+	appAddress := crypto.GetApplicationAddress(appId)
+	sdk.EnsureFunded(appAddress.String(), 100_000)
+
+	account, err := sdk.GetDefaultAccount()
+	if err != nil {
+		return nil, nil, err
+	}
+	sp, err := sdk.GetAlgodClient().SuggestedParams().Do(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get suggested params: %v", err)
+	}
+	deposit, err := transaction.MakePaymentTxn(account.Address.String(),
+		appAddress.String(), utils.SessionDeposit, nil,
+		types.ZeroAddress.String(), sp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to make payment txn: %v", err)
+	}
+	startArgs := append([]interface{}{transaction.TransactionWithSigner{
+		Txn:    deposit,
+		Signer: transaction.BasicAccountTransactionSigner{Account: *account},
+	}}, args...)
+
+	var atc = transaction.AtomicTransactionComposer{}
+	for _, call := range []struct {
+		method string
+		args   []interface{}
+	}{{"verify_start", startArgs}, {"verify_finish", args}} {
+		txnParams, err := sdk.BuildMethodCallParams(appId, schema, call.method,
+			types.NoOpOC, call.args, boxes, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to build method call params: %v",
+				err)
+		}
+		if err := atc.AddMethodCall(*txnParams); err != nil {
+			return nil, nil, fmt.Errorf("failed to add method call: %v", err)
+		}
+	}
+	if err := sdk.AddDummyTrasactions(&atc, 1); err != nil {
+		return nil, nil, err
+	}
+	res, err := sdk.ExecuteGroup(&atc, simulate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &res.MethodResults[0], &res.MethodResults[1], nil
+}
+
+// RegisterVerifyingKey makes a transaction group with app calls to appId's
+// "register_vk" method, writing vk to a box of a universal verifier generated
+// with verifier.WriteUniversalPythonCode, followed by a call to its
+// "finalize_vk" method. It funds the app account to cover the minimum balance
+// of the box.
+// A local network must be running with default parameters
+func RegisterVerifyingKey(appId uint64, schema *sdk.Arc56Schema,
+	vk plonk.VerifyingKey) error {
+
+	registrations, err := utils.RegisterVerifyingKeyMethodArgs(vk)
+	if err != nil {
+		return fmt.Errorf("failed to encode verifying key: %v", err)
+	}
+	vkHash := registrations[0][0].([]byte)
+	size := int(registrations[0][1].(uint64))
+	boxes := utils.VerifyingKeyBoxReferences(appId, vkHash, size)
+	boxSize := len(utils.VerifyingKeyBoxName(vkHash)) + size + 1
+	sdk.EnsureFunded(crypto.GetApplicationAddress(appId).String(),
+		100_000+2_500+400*uint64(boxSize))
+
+	var atc = transaction.AtomicTransactionComposer{}
+	for _, args := range registrations {
+		txnParams, err := sdk.BuildMethodCallParams(appId, schema, "register_vk",
+			types.NoOpOC, args, boxes, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build method call params: %v", err)
+		}
+		if err := atc.AddMethodCall(*txnParams); err != nil {
+			return fmt.Errorf("failed to add method call: %v", err)
+		}
+	}
+	txnParams, err := sdk.BuildMethodCallParams(appId, schema, "finalize_vk",
+		types.NoOpOC, []interface{}{vkHash}, boxes, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build method call params: %v", err)
+	}
+	if err := atc.AddMethodCall(*txnParams); err != nil {
+		return fmt.Errorf("failed to add method call: %v", err)
+	}
+	_, err = sdk.ExecuteGroup(&atc, false)
+	return err
+}
+
+// CallUniversalVerifyMethod calls the "verify" method of a universal verifier
+// generated with verifier.WriteUniversalPythonCode with the given proof and
+// public inputs, for the registered verifying key vk. If simulate is true, it
+// simulates the call instead of sending it, adding the maximum extra opcode
+// budget.
+// A local network must be running
+func CallUniversalVerifyMethod(appId uint64, schema *sdk.Arc56Schema,
+	vk plonk.VerifyingKey, proof []byte, publicInputs []byte, simulate bool,
+) (*transaction.ABIMethodResult, error) {
+	vkHash, err := verifier.UniversalVerifyingKeyHash(vk)
+	if err != nil {
+		return nil, err
+	}
+	vkData, err := verifier.MarshalUniversalVerifyingKey(vk)
+	if err != nil {
+		return nil, err
+	}
+	args, err := utils.ProofAndPublicInputsForAtomicComposer(proof, publicInputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode proof and public inputs: %v", err)
+	}
+	boxes := utils.VerifyingKeyBoxReferences(appId, vkHash, len(vkData))
+	return sdk.ExecuteAbiCall(appId, schema, "verify", types.NoOpOC,
+		append([]interface{}{vkHash}, args...), boxes, nil, simulate)
+}
+
 // CallLogicSigVerifier makes an app call to appId's "verify" method signed by lsig
 // with proof and public inputs as arguments, bundled in a transaction group
 // to pool size and opcode budget.
@@ -102,7 +323,7 @@ func CallLogicSigVerifier(appId uint64, schema *sdk.Arc56Schema,
 	lsig *crypto.LogicSigAccount, proof []byte, publicInputs []byte, simulate bool,
 ) error {
 	return callLogicSigVerifier(appId, schema, lsig, proof, publicInputs,
-		types.ZeroAddress, simulate)
+		nil, simulate)
 }
 
 // CallLogicSigVerifierWithRekey makes an app call to appId's "verify" method
@@ -110,14 +331,109 @@ func CallLogicSigVerifier(appId uint64, schema *sdk.Arc56Schema,
 func CallLogicSigVerifierWithRekey(appId uint64, schema *sdk.Arc56Schema,
 	lsig *crypto.LogicSigAccount, proof []byte, publicInputs []byte,
 	rekeyTo types.Address, simulate bool,
+) error {
+	return CallLogicSigVerifierWithTxn(appId, schema, lsig, proof, publicInputs,
+		func(txn *types.Transaction) { txn.RekeyTo = rekeyTo }, simulate)
+}
+
+// CallLogicSigVerifierWithTxn makes an app call to appId's "verify" method
+// signed by lsig like CallLogicSigVerifier, but lets `edit` change the
+// transaction before it is signed, e.g., to set the fields a malicious
+// submitter would set to drain the verifier account.
+func CallLogicSigVerifierWithTxn(appId uint64, schema *sdk.Arc56Schema,
+	lsig *crypto.LogicSigAccount, proof []byte, publicInputs []byte,
+	edit func(txn *types.Transaction), simulate bool,
 ) error {
 	return callLogicSigVerifier(appId, schema, lsig, proof, publicInputs,
-		rekeyTo, simulate)
+		edit, simulate)
+}
+
+// CallEscrowLogicSigVerifier makes the escrow logicsig verifier lsig, generated
+// with verifier.WithEscrow, sign a zero amount payment from its account to the
+// local network default account, with proof and public inputs as logicsig
+// arguments, bundled in a transaction group to pool opcode budget. `edit`, if
+// not nil, can change the payment before it is signed, e.g., to set the fields
+// a malicious submitter would set to drain the escrow account.
+// If simulate is true, it simulates the group instead of sending it.
+// A local network must be running with default parameters
+func CallEscrowLogicSigVerifier(lsig *crypto.LogicSigAccount, proof []byte,
+	publicInputs []byte, edit func(txn *types.Transaction), simulate bool,
+) error {
+	args, err := utils.EscrowLogicSigArgs(proof, publicInputs)
+	if err != nil {
+		return fmt.Errorf("failed to encode proof and public inputs: %v", err)
+	}
+	escrow := *lsig
+	escrow.Lsig.Args = args
+	escrowAddress, err := escrow.Address()
+	if err != nil {
+		return fmt.Errorf("failed to get escrow address: %v", err)
+	}
+	sdk.EnsureFunded(escrowAddress.String(), 1_000_000)
+
+	account, err := sdk.GetDefaultAccount()
+	if err != nil {
+		return fmt.Errorf("failed to get localnet default account: %v", err)
+	}
+	sp, err := sdk.GetAlgodClient().SuggestedParams().Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get suggested params: %v", err)
+	}
+	sp.FlatFee = true
+	sp.Fee = 0
+	txn, err := transaction.MakePaymentTxn(escrowAddress.String(),
+		account.Address.String(), 0, nil, types.ZeroAddress.String(), sp)
+	if err != nil {
+		return fmt.Errorf("failed to make payment txn: %v", err)
+	}
+	if edit != nil {
+		edit(&txn)
+	}
+
+	var atc = transaction.AtomicTransactionComposer{}
+	err = atc.AddTransaction(transaction.TransactionWithSigner{
+		Txn:    txn,
+		Signer: transaction.LogicSigAccountTransactionSigner{LogicSigAccount: escrow},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add payment: %v", err)
+	}
+	// fill the group to 16 transactions to get maximum logicsig opcode pool budget
+	err = sdk.AddDummyTrasactions(&atc, 15)
+	if err != nil {
+		return fmt.Errorf("failed to add dummy txns: %v", err)
+	}
+	_, err = sdk.ExecuteGroup(&atc, simulate)
+	return err
+}
+
+// LogicSigVerifierFailureReason returns the reason why the logicsig verifier in
+// teal file `tealFile`, generated with verifier.WithFailureReasons, rejected
+// the call that returned `callErr`, e.g., a simulated CallLogicSigVerifier, or
+// verifier.Verified if callErr is nil.
+// A local network must be running
+func LogicSigVerifierFailureReason(tealFile string, callErr error,
+) (verifier.FailureReason, error) {
+	if callErr == nil {
+		return verifier.Verified, nil
+	}
+	if !strings.Contains(callErr.Error(), "rejected by logic") {
+		return 0, fmt.Errorf("call not rejected by the logicsig: %v", callErr)
+	}
+	teal, err := os.ReadFile(tealFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read program from file: %v", err)
+	}
+	_, sourceMap, err := sdk.CompileTealWithSourceMap(teal)
+	if err != nil {
+		return 0, err
+	}
+	return utils.LogicSigFailureReason(teal, sourceMap, callErr.Error())
 }
 
 func callLogicSigVerifier(appId uint64, schema *sdk.Arc56Schema,
 	lsig *crypto.LogicSigAccount, proof []byte, publicInputs []byte,
-	rekeyTo types.Address, simulate bool,
+	edit func(txn *types.Transaction), simulate bool,
 ) error {
 	args, err := utils.ProofAndPublicInputsForAtomicComposer(proof, publicInputs)
 	if err != nil {
@@ -131,12 +447,26 @@ func callLogicSigVerifier(appId uint64, schema *sdk.Arc56Schema,
 	}
 	txnParams.SuggestedParams.Fee = 0
 	txnParams.SuggestedParams.FlatFee = true
-	txnParams.RekeyTo = rekeyTo
 
 	var atc = transaction.AtomicTransactionComposer{}
 	if err := atc.AddMethodCall(*txnParams); err != nil {
 		return fmt.Errorf("failed to add method call: %v", err)
 	}
+	if edit != nil {
+		// rebuild the composer with the edited transaction, which must not be
+		// grouped yet to be added again
+		txns, err := atc.BuildGroup()
+		if err != nil {
+			return fmt.Errorf("failed to build method call: %v", err)
+		}
+		txn := txns[0]
+		txn.Txn.Group = types.Digest{}
+		edit(&txn.Txn)
+		atc = transaction.AtomicTransactionComposer{}
+		if err := atc.AddTransaction(txn); err != nil {
+			return fmt.Errorf("failed to add edited transaction: %v", err)
+		}
+	}
 	// fill the group to 16 transactions to get maximum logicsig opcode pool budget
 	err = sdk.AddDummyTrasactions(&atc, 15)
 	if err != nil {
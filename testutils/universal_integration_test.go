@@ -0,0 +1,338 @@
+package testutils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/v2/types"
+	"github.com/consensys/gnark-crypto/ecc"
+	ap "github.com/giuliop/algoplonk"
+	"github.com/giuliop/algoplonk/setup"
+	sdk "github.com/giuliop/algoplonk/testutils/algosdkwrapper"
+	"github.com/giuliop/algoplonk/utils"
+	"github.com/giuliop/algoplonk/verifier"
+)
+
+// TestUniversalVerifier tests that a universal verifier verifies proofs of
+// two circuits with the verifying keys registered in its boxes, for both
+// BN254 and BLS12_381 curves
+func TestUniversalVerifier(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			verifierName := "VerifierUniversalForCurve" + curve.String()
+			puyaVerifierFilename := filepath.Join(artefactsFolder,
+				verifierName+".py")
+
+			f, err := os.Create(puyaVerifierFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = verifier.WriteUniversalPythonCode(curve, f)
+			f.Close()
+			if err != nil {
+				t.Fatalf("error writing PuyaPy verifier: %v", err)
+			}
+			err = utils.CompileWithPuyaPy(puyaVerifierFilename, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = utils.RenamePuyaPyOutput(verifier.DefaultFileName,
+				verifierName, artefactsFolder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+			if err != nil {
+				t.Fatalf("error deploying verifier app to local network: %v", err)
+			}
+			schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+				verifierName+".arc56.json"))
+			if err != nil {
+				t.Fatalf("failed to read application schema: %s", err)
+			}
+
+			for _, nbCommitments := range []int{1, 2} {
+				circuit := Bsb22Circuit{nbCommitments: nbCommitments}
+				assignment := Bsb22Circuit{Public: 9, Secret: 3}
+				compiledCircuit, err := ap.Compile(&circuit, curve,
+					setup.TestOnlySetup(curve))
+				if err != nil {
+					t.Fatalf("\nerror compiling circuit: %v", err)
+				}
+				verifiedProof, err := compiledCircuit.Verify(&assignment)
+				if err != nil {
+					t.Fatalf("\nerror during verification: %v", err)
+				}
+				var proof, publicInputs bytes.Buffer
+				if err := verifiedProof.WriteProof(&proof); err != nil {
+					t.Fatal(err)
+				}
+				if err := verifiedProof.WritePublicInputs(&publicInputs); err != nil {
+					t.Fatal(err)
+				}
+
+				err = RegisterVerifyingKey(appId, schema, compiledCircuit.Vk)
+				if err != nil {
+					t.Fatalf("error registering verifying key: %v", err)
+				}
+				// a finalized verifying key cannot be written again
+				err = RegisterVerifyingKey(appId, schema, compiledCircuit.Vk)
+				if err == nil {
+					t.Fatal("verifier app rewrote a finalized verifying key")
+				}
+
+				simulate := true
+				result, err := CallUniversalVerifyMethod(appId, schema,
+					compiledCircuit.Vk, proof.Bytes(), publicInputs.Bytes(),
+					simulate)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if result.DecodeError != nil {
+					t.Fatalf("error decoding result: %v", result.DecodeError)
+				}
+				if result.ReturnValue != true {
+					t.Fatalf("verifier app did not verify the proof with %d "+
+						"commitments", nbCommitments)
+				}
+
+				// now let's change the public inputs and see it fail
+				wrongInputs := publicInputs.Bytes()
+				wrongInputs[31] ^= 1
+				result, err = CallUniversalVerifyMethod(appId, schema,
+					compiledCircuit.Vk, proof.Bytes(), wrongInputs, simulate)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if result.ReturnValue != false {
+					t.Fatal("verifier app verified a proof for wrong public inputs")
+				}
+			}
+		})
+	}
+}
+
+// TestMultiVerifier tests that a verifier generated with
+// verifier.WriteMultiPythonCode verifies the proofs of each of its circuits
+// with their own method, for both BN254 and BLS12_381 curves
+func TestMultiVerifier(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			verifierName := "VerifierMultiForCurve" + curve.String()
+			puyaVerifierFilename := filepath.Join(artefactsFolder,
+				verifierName+".py")
+
+			names := []string{"single", "double"}
+			var vks []verifier.NamedVerifyingKey
+			var proofs, publicInputs [][]byte
+			for i, name := range names {
+				circuit := Bsb22Circuit{nbCommitments: i + 1}
+				assignment := Bsb22Circuit{Public: 9, Secret: 3}
+				compiledCircuit, err := ap.Compile(&circuit, curve,
+					setup.TestOnlySetup(curve))
+				if err != nil {
+					t.Fatalf("\nerror compiling circuit: %v", err)
+				}
+				verifiedProof, err := compiledCircuit.Verify(&assignment)
+				if err != nil {
+					t.Fatalf("\nerror during verification: %v", err)
+				}
+				var proof, inputs bytes.Buffer
+				if err := verifiedProof.WriteProof(&proof); err != nil {
+					t.Fatal(err)
+				}
+				if err := verifiedProof.WritePublicInputs(&inputs); err != nil {
+					t.Fatal(err)
+				}
+				vks = append(vks, verifier.NamedVerifyingKey{Name: name,
+					VerifyingKey: compiledCircuit.Vk})
+				proofs = append(proofs, proof.Bytes())
+				publicInputs = append(publicInputs, inputs.Bytes())
+			}
+
+			f, err := os.Create(puyaVerifierFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = verifier.WriteMultiPythonCode(vks, f)
+			f.Close()
+			if err != nil {
+				t.Fatalf("error writing PuyaPy verifier: %v", err)
+			}
+			err = utils.CompileWithPuyaPy(puyaVerifierFilename, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = utils.RenamePuyaPyOutput(verifier.DefaultFileName,
+				verifierName, artefactsFolder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+			if err != nil {
+				t.Fatalf("error deploying verifier app to local network: %v", err)
+			}
+			schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+				verifierName+".arc56.json"))
+			if err != nil {
+				t.Fatalf("failed to read application schema: %s", err)
+			}
+
+			simulate := true
+			for i, name := range names {
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(
+					proofs[i], publicInputs[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := sdk.ExecuteAbiCall(appId, schema, "verify_"+name,
+					types.NoOpOC, args, nil, nil, simulate)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if result.DecodeError != nil {
+					t.Fatalf("error decoding result: %v", result.DecodeError)
+				}
+				if result.ReturnValue != true {
+					t.Fatalf("verify_%s did not verify the proof", name)
+				}
+			}
+
+			// the proof of a circuit does not verify with the method of the
+			// other circuit
+			args, err := utils.ProofAndPublicInputsForAtomicComposer(proofs[1],
+				publicInputs[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = sdk.ExecuteAbiCall(appId, schema, "verify_single",
+				types.NoOpOC, args, nil, nil, simulate)
+			if err == nil {
+				t.Fatal("verify_single accepted a proof of the other circuit")
+			}
+		})
+	}
+}
+
+// TestMultiVerifierProgramSize tests that utils.CheckProgramSize tells whether
+// a verifier generated with verifier.WriteMultiPythonCode fits in an app
+// program, for one circuit and the most circuits that
+// verifier.EstimateMultiProgramSize estimates to fit, logging the estimate
+// against the compiled size and verifying proofs if the verifier fits, for
+// both BN254 and BLS12_381 curves
+func TestMultiVerifierProgramSize(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			circuit := BudgetCircuit{}
+			assignment := BudgetCircuit{Public: 9, Secret: 3}
+			compiledCircuit, err := ap.Compile(&circuit, curve,
+				setup.TestOnlySetup(curve))
+			if err != nil {
+				t.Fatalf("\nerror compiling circuit: %v", err)
+			}
+			verifiedProof, err := compiledCircuit.Verify(&assignment)
+			if err != nil {
+				t.Fatalf("\nerror during verification: %v", err)
+			}
+			var proof, publicInputs bytes.Buffer
+			if err := verifiedProof.WriteProof(&proof); err != nil {
+				t.Fatal(err)
+			}
+			if err := verifiedProof.WritePublicInputs(&publicInputs); err != nil {
+				t.Fatal(err)
+			}
+
+			// add circuits while the estimate fits in an app program
+			var vks []verifier.NamedVerifyingKey
+			for {
+				next := append(vks, verifier.NamedVerifyingKey{
+					Name:         fmt.Sprintf("c%d", len(vks)),
+					VerifyingKey: compiledCircuit.Vk})
+				size, err := verifier.EstimateMultiProgramSize(next)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > verifier.MaxProgramSize {
+					break
+				}
+				vks = next
+			}
+
+			for _, n := range []int{1, len(vks)} {
+				verifierName := fmt.Sprintf("VerifierMulti%dForCurve%s", n, curve)
+				puyaVerifierFilename := filepath.Join(artefactsFolder,
+					verifierName+".py")
+				f, err := os.Create(puyaVerifierFilename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = verifier.WriteMultiPythonCode(vks[:n], f)
+				f.Close()
+				if err != nil {
+					t.Fatalf("error writing PuyaPy verifier: %v", err)
+				}
+				err = utils.CompileWithPuyaPy(puyaVerifierFilename,
+					"--output-bytecode")
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = utils.RenamePuyaPyOutput(verifier.DefaultFileName,
+					verifierName, artefactsFolder)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				size, sizeErr := utils.CheckProgramSize(verifierName, artefactsFolder)
+				if size == 0 {
+					t.Fatal(sizeErr)
+				}
+				estimate, err := verifier.EstimateMultiProgramSize(vks[:n])
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Logf("%d circuits: program size %d bytes, estimate %d bytes",
+					n, size, estimate)
+				if (sizeErr != nil) != (size > verifier.MaxProgramSize) {
+					t.Fatalf("CheckProgramSize returned %v for %d bytes", sizeErr,
+						size)
+				}
+				if sizeErr != nil {
+					if n == 1 {
+						t.Fatal(sizeErr)
+					}
+					t.Logf("%d circuits do not fit in an app program: %v", n,
+						sizeErr)
+					continue
+				}
+
+				appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+				if err != nil {
+					t.Fatalf("error deploying verifier app to local network: %v", err)
+				}
+				schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+					verifierName+".arc56.json"))
+				if err != nil {
+					t.Fatalf("failed to read application schema: %s", err)
+				}
+				args, err := utils.ProofAndPublicInputsForAtomicComposer(
+					proof.Bytes(), publicInputs.Bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+				simulate := true
+				method := fmt.Sprintf("verify_c%d", n-1)
+				result, err := sdk.ExecuteAbiCall(appId, schema, method,
+					types.NoOpOC, args, nil, nil, simulate)
+				if err != nil {
+					t.Fatalf("error calling verifier app: %v", err)
+				}
+				if result.ReturnValue != true {
+					t.Fatalf("%s did not verify the proof", method)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package testutils
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"hash"
 	"math/big"
@@ -65,7 +67,12 @@ type logicsigVerifierTestCase struct {
 	publicInputs     []byte
 }
 
-func buildLogicsigVerifierTestCase(t *testing.T, curve ecc.ID) logicsigVerifierTestCase {
+// buildMerkleVerifier generates and compiles a verifier of type `verifierType`
+// for the merkle circuit, named `verifierName`, generated with `opts`, and
+// returns the proof and public inputs of a valid assignment
+func buildMerkleVerifier(t *testing.T, curve ecc.ID, verifierName string,
+	verifierType verifier.ContractType, opts ...verifier.Option,
+) (proof []byte, publicInputs []byte) {
 	t.Helper()
 
 	hash := mimcHasher(curve)
@@ -102,8 +109,6 @@ func buildLogicsigVerifierTestCase(t *testing.T, curve ecc.ID) logicsigVerifierT
 	assignment.Path = pathForProof
 	assignment.Index = indexForProof
 
-	verifierName := "VerifierLogicSigForCurve" + curve.String()
-
 	puyaVerifierFilename := filepath.Join(artefactsFolder, verifierName+".py")
 	proofFilename := filepath.Join(artefactsFolder, verifierName+".proof")
 	publicInputsFilename := filepath.Join(artefactsFolder,
@@ -119,7 +124,7 @@ func buildLogicsigVerifierTestCase(t *testing.T, curve ecc.ID) logicsigVerifierT
 		t.Fatalf("\nerror during verification: %v", err)
 	}
 	err = compiledCircuit.WritePuyaPyVerifier(puyaVerifierFilename,
-		verifier.LogicSig)
+		verifierType, opts...)
 	if err != nil {
 		t.Fatalf("error writing PuyaPy verifier: %v", err)
 	}
@@ -141,20 +146,33 @@ func buildLogicsigVerifierTestCase(t *testing.T, curve ecc.ID) logicsigVerifierT
 		t.Fatal(err)
 	}
 
-	verifierTealFile := filepath.Join(artefactsFolder, verifierName+".teal")
-	verifierLogicSig, err := sdk.LogicSigFromFile(verifierTealFile)
-	if err != nil {
-		t.Fatalf("error reading verifier logicsig: %v", err)
-	}
-
-	proof, err := os.ReadFile(proofFilename)
+	proof, err = os.ReadFile(proofFilename)
 	if err != nil {
 		t.Fatalf("failed to read proof file: %v", err)
 	}
-	publicInputs, err := os.ReadFile(publicInputsFilename)
+	publicInputs, err = os.ReadFile(publicInputsFilename)
 	if err != nil {
 		t.Fatalf("failed to read public inputs file: %v", err)
 	}
+	return proof, publicInputs
+}
+
+// buildLogicsigVerifierTestCase generates, compiles and deploys a logicsig
+// verifier for the merkle circuit, with a name prefixed by `name`, generated with
+// `opts`
+func buildLogicsigVerifierTestCase(t *testing.T, curve ecc.ID, name string,
+	opts ...verifier.Option) logicsigVerifierTestCase {
+	t.Helper()
+
+	verifierName := name + "ForCurve" + curve.String()
+	proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+		verifier.LogicSig, opts...)
+
+	verifierTealFile := filepath.Join(artefactsFolder, verifierName+".teal")
+	verifierLogicSig, err := sdk.LogicSigFromFile(verifierTealFile)
+	if err != nil {
+		t.Fatalf("error reading verifier logicsig: %v", err)
+	}
 
 	testAppId, testAppSchema, err := DeployAppWithVerifyMethod(artefactsFolder)
 	if err != nil {
@@ -174,7 +192,7 @@ func buildLogicsigVerifierTestCase(t *testing.T, curve ecc.ID) logicsigVerifierT
 // for both BLS12_381 and BN254 curves
 func TestLogicsigVerifier(t *testing.T) {
 	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
-		testCase := buildLogicsigVerifierTestCase(t, curve)
+		testCase := buildLogicsigVerifierTestCase(t, curve, "VerifierLogicSig")
 		proof := append([]byte(nil), testCase.proof...)
 		publicInputs := append([]byte(nil), testCase.publicInputs...)
 		simulate := true
@@ -232,7 +250,7 @@ func TestLogicsigVerifier(t *testing.T) {
 func TestLogicSigTemplatesRejectRekey(t *testing.T) {
 	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
 		t.Run(curve.String(), func(t *testing.T) {
-			testCase := buildLogicsigVerifierTestCase(t, curve)
+			testCase := buildLogicsigVerifierTestCase(t, curve, "VerifierLogicSig")
 			simulate := true
 
 			err := CallLogicSigVerifier(testCase.testAppId, testCase.testAppSchema,
@@ -255,6 +273,196 @@ func TestLogicSigTemplatesRejectRekey(t *testing.T) {
 	}
 }
 
+// TestLogicSigTemplatesRejectDraining tests that a logicsig verifier, both
+// signing app calls and as an escrow, rejects the transactions a malicious
+// submitter of a valid proof could make it sign to drain or close its account,
+// because of the transaction and not of the proof
+func TestLogicSigTemplatesRejectDraining(t *testing.T) {
+	attacker := crypto.GenerateAccount().Address
+	attacks := map[string]func(txn *types.Transaction){
+		"fee": func(txn *types.Transaction) {
+			txn.Fee = 1_000_000
+		},
+		"close remainder": func(txn *types.Transaction) {
+			txn.Type = types.PaymentTx
+			txn.ApplicationFields = types.ApplicationFields{}
+			txn.Receiver = attacker
+			txn.CloseRemainderTo = attacker
+		},
+		"asset close": func(txn *types.Transaction) {
+			txn.Type = types.AssetTransferTx
+			txn.ApplicationFields = types.ApplicationFields{}
+			txn.PaymentTxnFields = types.PaymentTxnFields{}
+			txn.XferAsset = 1
+			txn.AssetReceiver = attacker
+			txn.AssetCloseTo = attacker
+		},
+		"rekey": func(txn *types.Transaction) {
+			txn.RekeyTo = attacker
+		},
+	}
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			name := "VerifierLogicSigWithFailureReasons"
+			testCase := buildLogicsigVerifierTestCase(t, curve, name,
+				verifier.WithFailureReasons())
+			tealFile := filepath.Join(artefactsFolder,
+				name+"ForCurve"+curve.String()+".teal")
+			simulate := true
+
+			appCallAttacks := map[string]func(txn *types.Transaction){
+				"payment": func(txn *types.Transaction) {
+					txn.Type = types.PaymentTx
+					txn.ApplicationFields = types.ApplicationFields{}
+					txn.Receiver = attacker
+					txn.Amount = 1
+				},
+			}
+			for name, attack := range attacks {
+				appCallAttacks[name] = attack
+			}
+			for name, attack := range appCallAttacks {
+				err := CallLogicSigVerifierWithTxn(testCase.testAppId,
+					testCase.testAppSchema, testCase.verifierLogicSig, testCase.proof,
+					testCase.publicInputs, attack, simulate)
+				reason, err := LogicSigVerifierFailureReason(tealFile, err)
+				if err != nil {
+					t.Fatalf("error getting failure reason for %s: %v", name, err)
+				}
+				if reason != verifier.RejectedTransaction {
+					t.Fatalf("expected %s for %s, got %s",
+						verifier.RejectedTransaction, name, reason)
+				}
+			}
+		})
+
+		t.Run(curve.String()+"Escrow", func(t *testing.T) {
+			name := "VerifierEscrowLogicSigWithFailureReasons"
+			verifierName := name + "ForCurve" + curve.String()
+			proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+				verifier.LogicSig, verifier.WithEscrow(), verifier.WithFailureReasons())
+			tealFile := filepath.Join(artefactsFolder, verifierName+".teal")
+			escrow, err := sdk.LogicSigFromFile(tealFile)
+			if err != nil {
+				t.Fatalf("error reading escrow logicsig: %v", err)
+			}
+			simulate := true
+
+			err = CallEscrowLogicSigVerifier(escrow, proof, publicInputs, nil,
+				simulate)
+			if err != nil {
+				t.Fatalf("error calling escrow logicsig verifier: %v", err)
+			}
+
+			escrowAttacks := map[string]func(txn *types.Transaction){
+				"app call": func(txn *types.Transaction) {
+					txn.Type = types.ApplicationCallTx
+					txn.PaymentTxnFields = types.PaymentTxnFields{}
+					txn.ApplicationID = 1
+				},
+			}
+			for name, attack := range attacks {
+				escrowAttacks[name] = attack
+			}
+			for name, attack := range escrowAttacks {
+				err := CallEscrowLogicSigVerifier(escrow, proof, publicInputs, attack,
+					simulate)
+				reason, err := LogicSigVerifierFailureReason(tealFile, err)
+				if err != nil {
+					t.Fatalf("error getting failure reason for %s: %v", name, err)
+				}
+				if reason != verifier.RejectedTransaction {
+					t.Fatalf("expected %s for %s, got %s",
+						verifier.RejectedTransaction, name, reason)
+				}
+			}
+		})
+	}
+}
+
+// TestLogicSigTemplatesRequireLease tests that a logicsig verifier generated
+// with verifier.WithLease rejects transactions without a lease
+func TestLogicSigTemplatesRequireLease(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			testCase := buildLogicsigVerifierTestCase(t, curve,
+				"VerifierLogicSigWithLease", verifier.WithLease())
+			simulate := true
+
+			err := CallLogicSigVerifier(testCase.testAppId, testCase.testAppSchema,
+				testCase.verifierLogicSig, testCase.proof, testCase.publicInputs, simulate)
+			if err == nil {
+				t.Fatalf("Logicsig successful but was expected to require a lease")
+			}
+			if !strings.Contains(err.Error(), "rejected by logic") {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			err = CallLogicSigVerifierWithTxn(testCase.testAppId,
+				testCase.testAppSchema, testCase.verifierLogicSig, testCase.proof,
+				testCase.publicInputs, func(txn *types.Transaction) {
+					txn.Lease = [32]byte{1}
+				}, simulate)
+			if err != nil {
+				t.Fatalf("error calling logicsig verifier with lease: %v", err)
+			}
+		})
+	}
+}
+
+// TestLogicSigVerifierFailureReasons tests that the failures of a logicsig
+// verifier generated with verifier.WithFailureReasons map to their reasons
+func TestLogicSigVerifierFailureReasons(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			name := "VerifierLogicSigWithFailureReasons"
+			testCase := buildLogicsigVerifierTestCase(t, curve, name,
+				verifier.WithFailureReasons())
+			tealFile := filepath.Join(artefactsFolder,
+				name+"ForCurve"+curve.String()+".teal")
+			simulate := true
+
+			flippedPublicInputs := append([]byte(nil), testCase.publicInputs...)
+			flippedPublicInputs[31] ^= 1
+			nonCanonicalPublicInputs := append([]byte(nil), testCase.publicInputs...)
+			for i := 0; i < 32; i++ {
+				nonCanonicalPublicInputs[i] = 0xff
+			}
+			cases := []struct {
+				name         string
+				proof        []byte
+				publicInputs []byte
+				edit         func(txn *types.Transaction)
+				reason       verifier.FailureReason
+			}{
+				{"valid", testCase.proof, testCase.publicInputs, nil,
+					verifier.Verified},
+				{"flipped public input", testCase.proof, flippedPublicInputs, nil,
+					verifier.PairingFailed},
+				{"non canonical public input", testCase.proof,
+					nonCanonicalPublicInputs, nil, verifier.NonCanonicalPublicInput},
+				{"short proof", testCase.proof[:len(testCase.proof)-32],
+					testCase.publicInputs, nil, verifier.MalformedInput},
+				{"fee", testCase.proof, testCase.publicInputs,
+					func(txn *types.Transaction) { txn.Fee = 1_000_000 },
+					verifier.RejectedTransaction},
+			}
+			for _, c := range cases {
+				err := CallLogicSigVerifierWithTxn(testCase.testAppId,
+					testCase.testAppSchema, testCase.verifierLogicSig, c.proof,
+					c.publicInputs, c.edit, simulate)
+				reason, err := LogicSigVerifierFailureReason(tealFile, err)
+				if err != nil {
+					t.Fatalf("error getting failure reason for %s: %v", c.name, err)
+				}
+				if reason != c.reason {
+					t.Fatalf("expected %s for %s, got %s", c.reason, c.name, reason)
+				}
+			}
+		})
+	}
+}
+
 // TestSmartContractVerifier tests the verifier smart contract
 // for both BLS12_381 and BN254 curves
 func TestSmartContractVerifier(t *testing.T) {
@@ -438,6 +646,288 @@ func TestSmartContractVerifier(t *testing.T) {
 	}
 }
 
+// TestSmartContractVerifierWithBoxInputs tests that a smart contract verifier
+// generated with verifier.WithBoxInputs verifies a proof uploaded to a box
+func TestSmartContractVerifierWithBoxInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		verifierName := "VerifierSmartContractWithBoxInputsForCurve" +
+			curve.String()
+		proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+			verifier.SmartContract, verifier.WithBoxInputs())
+
+		appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+		if err != nil {
+			t.Fatalf("error deploying verifier app to local network: %v", err)
+		}
+		schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+			verifierName+".arc56.json"))
+		if err != nil {
+			t.Fatalf("failed to read application schema: %s", err)
+		}
+
+		simulate := true
+		result, err := CallVerifyUploadedMethod(appId, schema, proof,
+			publicInputs, simulate)
+		if err != nil {
+			t.Fatalf("error calling verifier app: %v", err)
+		}
+		if result.DecodeError != nil {
+			t.Fatalf("error decoding result: %v", result.DecodeError)
+		}
+		if result.ReturnValue != true {
+			t.Fatal("verifier app did not verify the uploaded proof")
+		}
+	}
+}
+
+// TestSmartContractVerifierWithResumableVerification tests that a smart
+// contract verifier generated with verifier.WithResumableVerification verifies
+// a proof across the app calls to verify_start and verify_finish, the first
+// taking the session deposit
+func TestSmartContractVerifierWithResumableVerification(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		verifierName := "VerifierSmartContractWithResumableVerificationForCurve" +
+			curve.String()
+		proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+			verifier.SmartContract, verifier.WithResumableVerification())
+
+		appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+		if err != nil {
+			t.Fatalf("error deploying verifier app to local network: %v", err)
+		}
+		schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+			verifierName+".arc56.json"))
+		if err != nil {
+			t.Fatalf("failed to read application schema: %s", err)
+		}
+
+		flippedPublicInputs := append([]byte(nil), publicInputs...)
+		flippedPublicInputs[31] ^= 1
+		simulate := true
+		for _, c := range []struct {
+			publicInputs []byte
+			valid        bool
+		}{{publicInputs, true}, {flippedPublicInputs, false}} {
+			start, finish, err := CallResumableVerifyMethods(appId, schema,
+				proof, c.publicInputs, simulate)
+			if err != nil {
+				t.Fatalf("error calling verifier app: %v", err)
+			}
+			if start.DecodeError != nil || finish.DecodeError != nil {
+				t.Fatalf("error decoding results: %v %v", start.DecodeError,
+					finish.DecodeError)
+			}
+			if start.ReturnValue != true {
+				t.Fatal("verify_start rejected well formed inputs")
+			}
+			if finish.ReturnValue != c.valid {
+				t.Fatalf("verify_finish returned %v, want %v",
+					finish.ReturnValue, c.valid)
+			}
+		}
+	}
+}
+
+// TestSmartContractVerifierWithVerifiedEvent tests that a smart contract
+// verifier generated with verifier.WithVerifiedEvent emits the verified event
+// for a valid proof
+func TestSmartContractVerifierWithVerifiedEvent(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		verifierName := "VerifierSmartContractWithVerifiedEventForCurve" +
+			curve.String()
+		proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+			verifier.SmartContract, verifier.WithVerifiedEvent(true))
+
+		appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+		if err != nil {
+			t.Fatalf("error deploying verifier app to local network: %v", err)
+		}
+		schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+			verifierName+".arc56.json"))
+		if err != nil {
+			t.Fatalf("failed to read application schema: %s", err)
+		}
+
+		args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+			publicInputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simulate := true
+		result, err := sdk.ExecuteAbiCall(appId, schema, "verify", types.NoOpOC,
+			args, nil, nil, simulate)
+		if err != nil {
+			t.Fatalf("error calling verifier app: %v", err)
+		}
+		var events []*utils.VerifiedEvent
+		for _, log := range result.TransactionInfo.Logs {
+			if event, err := utils.DecodeVerifiedEvent(log); err == nil {
+				events = append(events, event)
+			}
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected one verified event, got %d", len(events))
+		}
+		publicInputsHash := sha256.Sum256(publicInputs)
+		if !bytes.Equal(events[0].PublicInputsHash, publicInputsHash[:]) {
+			t.Fatalf("wrong public inputs hash in verified event")
+		}
+		if !bytes.Equal(events[0].PublicInputs, publicInputs) {
+			t.Fatalf("wrong public inputs in verified event")
+		}
+	}
+}
+
+func TestSmartContractVerifierWithTypedPublicInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		verifierName := "VerifierSmartContractWithTypedPublicInputsForCurve" +
+			curve.String()
+		proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+			verifier.SmartContract,
+			verifier.WithTypedPublicInputs(&MerkleCircuit{}))
+
+		appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+		if err != nil {
+			t.Fatalf("error deploying verifier app to local network: %v", err)
+		}
+		schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+			verifierName+".arc56.json"))
+		if err != nil {
+			t.Fatalf("failed to read application schema: %s", err)
+		}
+		for _, m := range schema.Methods {
+			if m.Name == "verify" && (len(m.Args) != 2 ||
+				m.Args[1].Name != "root_hash" || m.Args[1].Type != "uint256") {
+				t.Fatalf("unexpected arguments of verify in ARC-56 schema")
+			}
+		}
+
+		args, err := utils.TypedVerifyMethodArgs(proof,
+			&MerkleCircuit{RootHash: publicInputs}, curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simulate := true
+		result, err := sdk.ExecuteAbiCall(appId, schema, "verify", types.NoOpOC,
+			args, nil, nil, simulate)
+		if err != nil {
+			t.Fatalf("error calling verifier app: %v", err)
+		}
+		if result.DecodeError != nil {
+			t.Fatalf("error decoding result: %v", result.DecodeError)
+		}
+		if result.ReturnValue != true {
+			t.Fatal("verifier app did not verify the proof")
+		}
+	}
+}
+
+// TestSmartContractVerifierWithPostVerifyHook tests that a space-indented
+// hook with nested blocks compiles into a verifier with typed public inputs,
+// and that it receives the typed fields of a verified proof
+func TestSmartContractVerifierWithPostVerifyHook(t *testing.T) {
+	hook := `
+    for i in urange(2):
+        if i == 1:
+            py.log(root_hash.bytes)
+`
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		verifierName := "VerifierSmartContractWithPostVerifyHookForCurve" +
+			curve.String()
+		proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+			verifier.SmartContract,
+			verifier.WithTypedPublicInputs(&MerkleCircuit{}),
+			verifier.WithPostVerifyHook(hook))
+
+		appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+		if err != nil {
+			t.Fatalf("error deploying verifier app to local network: %v", err)
+		}
+		schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+			verifierName+".arc56.json"))
+		if err != nil {
+			t.Fatalf("failed to read application schema: %s", err)
+		}
+
+		args, err := utils.TypedVerifyMethodArgs(proof,
+			&MerkleCircuit{RootHash: publicInputs}, curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simulate := true
+		result, err := sdk.ExecuteAbiCall(appId, schema, "verify", types.NoOpOC,
+			args, nil, nil, simulate)
+		if err != nil {
+			t.Fatalf("error calling verifier app: %v", err)
+		}
+		if result.ReturnValue != true {
+			t.Fatal("verifier app did not verify the proof")
+		}
+		logged := false
+		for _, log := range result.TransactionInfo.Logs {
+			logged = logged || bytes.Equal(log, publicInputs)
+		}
+		if !logged {
+			t.Fatal("hook did not log the root hash of the verified proof")
+		}
+	}
+}
+
+// TestSmartContractVerifierWithFailureReasons tests that a smart contract
+// verifier generated with verifier.WithFailureReasons returns the reason why
+// it rejects a proof
+func TestSmartContractVerifierWithFailureReasons(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		verifierName := "VerifierSmartContractWithFailureReasonsForCurve" +
+			curve.String()
+		proof, publicInputs := buildMerkleVerifier(t, curve, verifierName,
+			verifier.SmartContract, verifier.WithFailureReasons())
+
+		appId, err := sdk.DeployArc4AppIfNeeded(verifierName, artefactsFolder)
+		if err != nil {
+			t.Fatalf("error deploying verifier app to local network: %v", err)
+		}
+		schema, err := sdk.ReadArc56Schema(filepath.Join(artefactsFolder,
+			verifierName+".arc56.json"))
+		if err != nil {
+			t.Fatalf("failed to read application schema: %s", err)
+		}
+
+		flippedPublicInputs := append([]byte(nil), publicInputs...)
+		flippedPublicInputs[31] ^= 1
+		cases := []struct {
+			name         string
+			publicInputs []byte
+			reason       verifier.FailureReason
+		}{
+			{"valid", publicInputs, verifier.Verified},
+			{"flipped public input", flippedPublicInputs, verifier.PairingFailed},
+			{"short public inputs", publicInputs[:len(publicInputs)-32],
+				verifier.MalformedInput},
+		}
+		simulate := true
+		for _, c := range cases {
+			args, err := utils.ProofAndPublicInputsForAtomicComposer(proof,
+				c.publicInputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sdk.ExecuteAbiCall(appId, schema, "verify_with_reason",
+				types.NoOpOC, args, nil, nil, simulate)
+			if err != nil {
+				t.Fatalf("error calling verifier app for %s: %v", c.name, err)
+			}
+			if result.DecodeError != nil {
+				t.Fatalf("error decoding result: %v", result.DecodeError)
+			}
+			if result.ReturnValue != uint8(c.reason) {
+				t.Fatalf("expected %s for %s, got %v", c.reason, c.name,
+					result.ReturnValue)
+			}
+		}
+	}
+}
+
 // mimcHash hasesh data matching the circuit MiMC hashing
 func mimcHasher(curve ecc.ID) HashFunc {
 	var m hash.Hash
@@ -4,17 +4,28 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/gob"
 	"fmt"
+	"math/big"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/algorand/avm-abi/abi"
+	"github.com/algorand/go-algorand-sdk/v2/logic"
+	"github.com/algorand/go-algorand-sdk/v2/types"
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
 	ap "github.com/giuliop/algoplonk"
+	"github.com/giuliop/algoplonk/verifier"
 )
 
 // CompileWithPuyaPy compiles `filepath` with puyapy, with `options'.
@@ -36,10 +47,12 @@ func CompileWithPuyaPy(filepath string, options string) error {
 // RenamePuyaPyOutput renames puyapy output files, e.g.,
 // 'oldname.approval.teal' is renamed to 'newname.approval.teal'.
 // It looks in `dir` for the files to rename, looking for these files:
-// oldname.approval.teal, oldname.clear.teal, oldname.arc56.json, oldname.teal
+// oldname.approval.teal, oldname.clear.teal, oldname.arc56.json, oldname.teal,
+// their source maps and the bytecode of the approval and clear programs
 func RenamePuyaPyOutput(oldname string, newname string, dir string) error {
 	suffixes := []string{"approval.teal", "clear.teal", "arc56.json", "teal",
-		"approval.puya.map", "clear.puya.map", "puya.map"}
+		"approval.puya.map", "clear.puya.map", "puya.map", "approval.bin",
+		"clear.bin"}
 	renamedAtLeastOne := false
 	for _, suffix := range suffixes {
 		oldfile := filepath.Join(dir, oldname+"."+suffix)
@@ -63,6 +76,28 @@ func RenamePuyaPyOutput(oldname string, newname string, dir string) error {
 	return nil
 }
 
+// CheckProgramSize returns the size in bytes of the approval and clear
+// programs of app `name` in `dir`, compiled with CompileWithPuyaPy with the
+// "--output-bytecode" option, and an error if it exceeds the
+// verifier.MaxProgramSize bytes an app program can hold, e.g., for a verifier
+// generated with verifier.WriteMultiPythonCode
+func CheckProgramSize(name string, dir string) (int, error) {
+	size := 0
+	for _, program := range []string{"approval", "clear"} {
+		filename := filepath.Join(dir, name+"."+program+".bin")
+		bytecode, err := os.ReadFile(filename)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %v", filename, err)
+		}
+		size += len(bytecode)
+	}
+	if size > verifier.MaxProgramSize {
+		return size, fmt.Errorf("program size %d bytes exceeds the %d bytes "+
+			"of an app program", size, verifier.MaxProgramSize)
+	}
+	return size, nil
+}
+
 // shouldRecompile returns true if targetPath is more recent than any of the files in
 // sourcePahts or if it encounters any error
 func ShouldRecompile(targetPath string, sourcePaths ...string) bool {
@@ -193,6 +228,464 @@ func AbiEncodeProofAndPublicInputs(proof []byte, publicInputs []byte) ([][]byte,
 	return [][]byte{encodedProof, encodedPublicInputs}, nil
 }
 
+// ProofAndPublicInputsMethodArgs takes a proof and public input binary blob and
+// returns `methodArgs`, the arguments of an ABI method call for the
+// AtomicTransactionComposer, with the proof and public inputs placed where a
+// logicsig verifier generated with verifier.WithGroupArgs(groupIndex,
+// proofArg, publicInputsArg) reads them. App argument i is method argument
+// i-1, after the method selector; `methodArgs` is extended with nil arguments
+// if it is too short
+func ProofAndPublicInputsMethodArgs(methodArgs []interface{}, proof []byte,
+	publicInputs []byte, proofArg int, publicInputsArg int) ([]interface{}, error) {
+
+	if err := checkArgPositions(proofArg, publicInputsArg, 1); err != nil {
+		return nil, err
+	}
+	args, err := ProofAndPublicInputsForAtomicComposer(proof, publicInputs)
+	if err != nil {
+		return nil, err
+	}
+	methodArgs = append([]interface{}{}, methodArgs...)
+	for len(methodArgs) < max(proofArg, publicInputsArg) {
+		methodArgs = append(methodArgs, nil)
+	}
+	methodArgs[proofArg-1] = args[0]
+	methodArgs[publicInputsArg-1] = args[1]
+	return methodArgs, nil
+}
+
+// ProofAndPublicInputsAppArgs takes a proof and public input binary blob and
+// returns `appArgs`, the arguments of an app call, with the proof and public
+// inputs ABI encoded where a logicsig verifier generated with
+// verifier.WithGroupArgs(groupIndex, proofArg, publicInputsArg) reads them;
+// `appArgs` is extended with empty arguments if it is too short
+func ProofAndPublicInputsAppArgs(appArgs [][]byte, proof []byte,
+	publicInputs []byte, proofArg int, publicInputsArg int) ([][]byte, error) {
+
+	if err := checkArgPositions(proofArg, publicInputsArg, 0); err != nil {
+		return nil, err
+	}
+	args, err := AbiEncodeProofAndPublicInputs(proof, publicInputs)
+	if err != nil {
+		return nil, err
+	}
+	appArgs = append([][]byte{}, appArgs...)
+	for len(appArgs) <= max(proofArg, publicInputsArg) {
+		appArgs = append(appArgs, []byte{})
+	}
+	appArgs[proofArg] = args[0]
+	appArgs[publicInputsArg] = args[1]
+	return appArgs, nil
+}
+
+// EscrowLogicSigArgs takes a proof and public input binary blob and returns
+// them as the logicsig arguments expected by the escrow logicsig verifiers
+// generated with verifier.WithEscrow
+func EscrowLogicSigArgs(proof []byte, publicInputs []byte) ([][]byte, error) {
+
+	if len(proof)%32 != 0 || len(publicInputs)%32 != 0 {
+		return nil, fmt.Errorf("proof and public inputs must be 32-byte aligned")
+	}
+	return [][]byte{proof, publicInputs}, nil
+}
+
+// SessionDeposit is the payment in microalgos to the app account that the
+// `verify_start` method of a verifier generated with
+// verifier.WithResumableVerification takes, covering the minimum balance of
+// the session box, and refunds when the session is deleted
+const SessionDeposit = 108_500
+
+// SessionBoxName returns the name of the box where a verifier generated with
+// verifier.WithResumableVerification saves the progress of the verification of
+// `proof` for `publicInputs`, for the box references of the verify_start,
+// verify_finish and delete_session calls
+func SessionBoxName(proof []byte, publicInputs []byte) ([]byte, error) {
+	args, err := AbiEncodeProofAndPublicInputs(proof, publicInputs)
+	if err != nil {
+		return nil, err
+	}
+	session := sha256.Sum256(append(args[0], args[1]...))
+	return append([]byte("s"), session[:]...), nil
+}
+
+// NullifierDeposit is the payment in microalgos to the app account that must
+// precede an app call spending a nullifier of a verifier generated with
+// verifier.WithNullifier, covering the minimum balance of the nullifier box
+const NullifierDeposit = 18_900
+
+// NullifierBoxName returns the name of the box where a verifier generated with
+// verifier.WithNullifier(index) records the nullifier of `publicInputs`, that
+// is the public input at position `index`
+func NullifierBoxName(publicInputs []byte, index int) ([]byte, error) {
+	if len(publicInputs)%32 != 0 {
+		return nil, fmt.Errorf("public inputs must be 32-byte aligned")
+	}
+	if index < 0 || index >= len(publicInputs)/32 {
+		return nil, fmt.Errorf("nullifier index %d out of range for %d public inputs",
+			index, len(publicInputs)/32)
+	}
+	return append([]byte("n"), publicInputs[index*32:index*32+32]...), nil
+}
+
+// NullifierBoxReference returns the box reference to add to the app calls to
+// the `verify` method of verifier app `appId`, generated with
+// verifier.WithNullifier(index), for `publicInputs`
+func NullifierBoxReference(appId uint64, publicInputs []byte, index int,
+) (types.AppBoxReference, error) {
+	name, err := NullifierBoxName(publicInputs, index)
+	if err != nil {
+		return types.AppBoxReference{}, err
+	}
+	return types.AppBoxReference{AppID: appId, Name: name}, nil
+}
+
+// UploadChunkSize is the largest chunk of proof and public inputs that
+// UploadMethodArgs passes to an `upload` call, leaving room in the 2,048 bytes
+// of app call arguments for the method selector and the offset
+const UploadChunkSize = 2000
+
+// UploadBoxName returns the name of the box where a verifier generated with
+// verifier.WithBoxInputs holds the proof and public inputs uploaded by `sender`
+func UploadBoxName(sender types.Address) []byte {
+	return append([]byte("u"), sender[:]...)
+}
+
+// UploadDeposit returns the payment in microalgos to the app account that the
+// `start_upload` method of a verifier generated with verifier.WithBoxInputs
+// takes to upload `proof` and `publicInputs`, covering the minimum balance of
+// the upload box, and refunds when the upload is deleted
+func UploadDeposit(proof []byte, publicInputs []byte) uint64 {
+	return 2_500 + 400*uint64(len(UploadBoxName(types.ZeroAddress))+len(proof)+
+		len(publicInputs))
+}
+
+// UploadBoxReferences returns the box references to add to each app call of
+// `sender` to the `start_upload`, `upload`, `verify_uploaded` and
+// `delete_upload` methods of verifier app `appId`, generated with
+// verifier.WithBoxInputs, for `proof` and `publicInputs`: the upload box,
+// followed by empty references raising the box read and write budget of the
+// group, 1,024 bytes per reference, to the size of the box
+func UploadBoxReferences(appId uint64, sender types.Address, proof []byte,
+	publicInputs []byte) []types.AppBoxReference {
+	name := UploadBoxName(sender)
+	size := len(name) + len(proof) + len(publicInputs)
+	boxes := []types.AppBoxReference{{AppID: appId, Name: name}}
+	for budget := 1024; budget < size; budget += 1024 {
+		boxes = append(boxes, types.AppBoxReference{AppID: appId})
+	}
+	return boxes
+}
+
+// UploadMethodArgs takes a proof and public input binary blob and returns the
+// method arguments of the `upload` calls writing them, in chunks of at most
+// UploadChunkSize bytes, to the upload box of a verifier generated with
+// verifier.WithBoxInputs, as expected by the AtomicTransactionComposer. The
+// calls can be sent in any order, after the call to `start_upload` and before
+// the call to `verify_uploaded`
+func UploadMethodArgs(proof []byte, publicInputs []byte) ([][]interface{}, error) {
+	if len(proof)%32 != 0 || len(publicInputs)%32 != 0 {
+		return nil, fmt.Errorf("proof and public inputs must be 32-byte aligned")
+	}
+	data := append(append([]byte{}, proof...), publicInputs...)
+	var args [][]interface{}
+	for offset := 0; offset < len(data); offset += UploadChunkSize {
+		end := min(offset+UploadChunkSize, len(data))
+		args = append(args, []interface{}{uint64(offset), data[offset:end]})
+	}
+	return args, nil
+}
+
+// VerifyingKeyChunkSize is the largest chunk of a verifying key that
+// RegisterVerifyingKeyMethodArgs passes to a `register_vk` call, leaving room
+// in the 2,048 bytes of app call arguments for the method selector, the hash
+// of the verifying key, its size and the offset
+const VerifyingKeyChunkSize = 1950
+
+// VerifyingKeyBoxName returns the name of the box where a universal verifier
+// generated with verifier.WriteUniversalPythonCode holds the verifying key with
+// hash `vkHash`, as returned by verifier.UniversalVerifyingKeyHash
+func VerifyingKeyBoxName(vkHash []byte) []byte {
+	return append([]byte("v"), vkHash...)
+}
+
+// VerifyingKeyBoxReferences returns the box references to add to each app call
+// to the `register_vk`, `finalize_vk` and `verify` methods of universal
+// verifier app `appId` for the verifying key with hash `vkHash`, serialized in
+// `size` bytes: the verifying key box, followed by empty references raising
+// the box read and write budget of the group, 1,024 bytes per reference, to
+// the size of the box, which holds the key and its finalization status byte
+func VerifyingKeyBoxReferences(appId uint64, vkHash []byte, size int,
+) []types.AppBoxReference {
+	name := VerifyingKeyBoxName(vkHash)
+	boxes := []types.AppBoxReference{{AppID: appId, Name: name}}
+	for budget := 1024; budget < len(name)+size+1; budget += 1024 {
+		boxes = append(boxes, types.AppBoxReference{AppID: appId})
+	}
+	return boxes
+}
+
+// RegisterVerifyingKeyMethodArgs takes a verifying key and returns the method
+// arguments of the `register_vk` calls writing it, in chunks of at most
+// VerifyingKeyChunkSize bytes, to a universal verifier generated with
+// verifier.WriteUniversalPythonCode, as expected by the
+// AtomicTransactionComposer. The calls can be sent in any order, by the
+// creator of the verifier, followed by a `finalize_vk` call with the hash of
+// the verifying key, the first argument of each call
+func RegisterVerifyingKeyMethodArgs(vk plonk.VerifyingKey) ([][]interface{}, error) {
+	data, err := verifier.MarshalUniversalVerifyingKey(vk)
+	if err != nil {
+		return nil, err
+	}
+	vkHash, err := verifier.UniversalVerifyingKeyHash(vk)
+	if err != nil {
+		return nil, err
+	}
+	var args [][]interface{}
+	for offset := 0; offset < len(data); offset += VerifyingKeyChunkSize {
+		end := min(offset+VerifyingKeyChunkSize, len(data))
+		args = append(args, []interface{}{vkHash, uint64(len(data)),
+			uint64(offset), data[offset:end]})
+	}
+	return args, nil
+}
+
+// TypedVerifyMethodArgs takes a proof binary blob and a circuit assignment and
+// returns the method arguments of a call to the `verify` method of a verifier
+// generated with verifier.WithTypedPublicInputs, as expected by the
+// AtomicTransactionComposer: the proof followed by the public fields of the
+// assignment, a *big.Int for each public variable and an []interface{} for
+// each public array
+func TypedVerifyMethodArgs(proof []byte, assignment frontend.Circuit,
+	curve ecc.ID) ([]interface{}, error) {
+
+	if len(proof)%32 != 0 {
+		return nil, fmt.Errorf("proof must be 32-byte aligned")
+	}
+	fields, err := verifier.PublicFields(assignment, curve)
+	if err != nil {
+		return nil, err
+	}
+	witness, err := frontend.NewWitness(assignment, curve.ScalarField(),
+		frontend.PublicOnly())
+	if err != nil {
+		return nil, fmt.Errorf("error creating public witness: %v", err)
+	}
+	publicInputs, err := ap.MarshalPublicInputs(witness)
+	if err != nil {
+		return nil, err
+	}
+	values := chunks(publicInputs)
+	args := []interface{}{chunks(proof)}
+	for _, f := range fields {
+		var arg interface{}
+		arg, values = typedArg(f.Dimensions, values)
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// typedArg returns the method argument of a public field of dimensions
+// `dims`, taking its values from the start of `values`, and the values left
+func typedArg(dims []int, values [][]byte) (interface{}, [][]byte) {
+	if len(dims) == 0 {
+		return new(big.Int).SetBytes(values[0]), values[1:]
+	}
+	arg := make([]interface{}, dims[0])
+	for i := range arg {
+		arg[i], values = typedArg(dims[1:], values)
+	}
+	return arg, values
+}
+
+// VerifiedEvent is the ARC-28 event a smart contract verifier generated with
+// verifier.WithVerifiedEvent emits for each valid proof
+type VerifiedEvent struct {
+	// VerifyingKeyHash is the verifier.VerifyingKeyHash of the verifier
+	VerifyingKeyHash []byte
+	// PublicInputsHash is the SHA-256 hash of the public inputs, as exported
+	// by AlgoPlonk
+	PublicInputsHash []byte
+	// PublicInputs are the public inputs, as exported by AlgoPlonk, or nil if
+	// the verifier does not include them in the event
+	PublicInputs []byte
+}
+
+// DecodeVerifiedEvent decodes `log`, one of the logs of an app call to a
+// verifier generated with verifier.WithVerifiedEvent, as a VerifiedEvent. It
+// returns an error if `log` is not a verified event, e.g., for the ABI return
+// value or other events
+func DecodeVerifiedEvent(log []byte) (*VerifiedEvent, error) {
+	if len(log) < 4+32+32 {
+		return nil, fmt.Errorf("log of %d bytes too short for a verified event",
+			len(log))
+	}
+	event := &VerifiedEvent{
+		VerifyingKeyHash: log[4:36],
+		PublicInputsHash: log[36:68],
+	}
+	selector := log[:4]
+	data := log[68:]
+	switch {
+	case bytes.Equal(selector, arc28Selector(verifier.VerifiedEventSignature)):
+		if len(data) != 0 {
+			return nil, fmt.Errorf("unexpected %d bytes after verified event",
+				len(data))
+		}
+	case bytes.Equal(selector,
+		arc28Selector(verifier.VerifiedEventWithPublicInputsSignature)):
+		// the offset of the public inputs from the start of the tuple,
+		// followed by their number and values
+		if len(data) < 4 || binary.BigEndian.Uint16(data[:2]) != 32+32+2 {
+			return nil, fmt.Errorf("malformed public inputs in verified event")
+		}
+		n := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) != 4+32*n {
+			return nil, fmt.Errorf("verified event of %d bytes does not hold %d "+
+				"public inputs", len(log), n)
+		}
+		event.PublicInputs = data[4:]
+	default:
+		return nil, fmt.Errorf("log is not a verified event")
+	}
+	return event, nil
+}
+
+// arc28Selector returns the 4-byte selector of the ARC-28 event `signature`
+func arc28Selector(signature string) []byte {
+	h := sha512.Sum512_256([]byte(signature))
+	return h[:4]
+}
+
+// failurePcRegexp matches the program counter of a logic evaluation failure
+var failurePcRegexp = regexp.MustCompile(`pc=(\d+)`)
+
+// failureCommentRegexp matches the assert message PuyaPy writes as a comment of
+// a TEAL line
+var failureCommentRegexp = regexp.MustCompile(`//\s*([A-Z_]+)\s*$`)
+
+// LogicSigFailureReason returns the reason why a logicsig verifier generated
+// with verifier.WithFailureReasons rejected a transaction, taking the failure
+// message of the simulation or evaluation of the transaction, the TEAL program
+// of the verifier and its source map, as returned by algod when compiling
+// `teal` with the sourcemap option. It returns an error if the failure did not
+// happen at one of the asserts of the verifier, e.g., for a budget exhaustion
+func LogicSigFailureReason(teal []byte, sourceMap logic.SourceMap,
+	failureMessage string) (verifier.FailureReason, error) {
+	match := failurePcRegexp.FindStringSubmatch(failureMessage)
+	if match == nil {
+		return 0, fmt.Errorf("no program counter in failure message %q",
+			failureMessage)
+	}
+	pc, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid program counter in failure message: %v", err)
+	}
+	line, ok := sourceMap.GetLineForPc(pc)
+	if !ok {
+		return 0, fmt.Errorf("program counter %d not in source map", pc)
+	}
+	lines := strings.Split(string(teal), "\n")
+	if line < 0 || line >= len(lines) {
+		return 0, fmt.Errorf("source map line %d not in program", line)
+	}
+	comment := failureCommentRegexp.FindStringSubmatch(lines[line])
+	if comment == nil {
+		return 0, fmt.Errorf("no failure reason at line %d: %q", line,
+			strings.TrimSpace(lines[line]))
+	}
+	return verifier.ParseFailureReason(comment[1])
+}
+
+// FieldElementsFromBytes returns the two public inputs that a logicsig
+// verifier generated with verifier.WithTxnBinding matches to the 32-byte
+// transaction field `b`, e.g., a group ID: the high and low 128 bits of `b` as
+// big-endian integers
+func FieldElementsFromBytes(b []byte) (hi *big.Int, lo *big.Int) {
+	x := new(big.Int).SetBytes(b)
+	lo = new(big.Int).And(x, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128),
+		big.NewInt(1)))
+	hi = x.Rsh(x, 128)
+	return hi, lo
+}
+
+// FieldElementsFromAddress returns the two public inputs that a logicsig
+// verifier generated with verifier.WithTxnBinding matches to `address`
+func FieldElementsFromAddress(address types.Address) (hi *big.Int, lo *big.Int) {
+	return FieldElementsFromBytes(address[:])
+}
+
+// FieldElementFromUint64 returns the public input that a logicsig verifier
+// generated with verifier.WithTxnBinding matches to the integer transaction
+// field `v`, e.g., an amount or a round
+func FieldElementFromUint64(v uint64) *big.Int {
+	return new(big.Int).SetUint64(v)
+}
+
+// Network is the profile of an Algorand network, identified by its genesis
+// hash, to bind proofs to with verifiers generated with
+// verifier.WithDomainSeparation
+type Network struct {
+	Name        string
+	GenesisHash [32]byte
+}
+
+var (
+	// MainNet and TestNet are the profiles of the public Algorand networks
+	MainNet = mustNetwork("mainnet", "wGHE2Pwdvd7S12BL5FaOP20EGYesN73ktiC1qzkkit8=")
+	TestNet = mustNetwork("testnet", "SGO1GKSzyE7IEPItTxCByw9x8FmnrCDexi9/cOUJOiI=")
+)
+
+// NewNetwork returns the profile of network `name` with genesis hash
+// `genesisHash`, e.g., as returned by algod in the suggested params of a local
+// network
+func NewNetwork(name string, genesisHash []byte) (Network, error) {
+	n := Network{Name: name}
+	if len(genesisHash) != len(n.GenesisHash) {
+		return n, fmt.Errorf("genesis hash must be 32 bytes, got %d",
+			len(genesisHash))
+	}
+	copy(n.GenesisHash[:], genesisHash)
+	return n, nil
+}
+
+// DomainPublicInputs returns the public inputs that a verifier generated with
+// verifier.WithDomainSeparation expects from proofs for app `appId` on network
+// `n`, to assign in the circuit: the high and low 128 bits of the genesis hash
+// of `n` and the app ID
+func (n Network) DomainPublicInputs(appId uint64,
+) (genesisHashHi, genesisHashLo, appID *big.Int) {
+	genesisHashHi, genesisHashLo = FieldElementsFromBytes(n.GenesisHash[:])
+	return genesisHashHi, genesisHashLo, FieldElementFromUint64(appId)
+}
+
+// mustNetwork returns the profile of network `name` with base64 encoded
+// genesis hash `genesisHash`, panicking if it is not valid
+func mustNetwork(name string, genesisHash string) Network {
+	b, err := base64.StdEncoding.DecodeString(genesisHash)
+	if err != nil {
+		panic(err)
+	}
+	n, err := NewNetwork(name, b)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// checkArgPositions returns an error if the app argument positions of the
+// proof and public inputs are equal or outside [first, 16)
+func checkArgPositions(proofArg int, publicInputsArg int, first int) error {
+	for _, arg := range []int{proofArg, publicInputsArg} {
+		if arg < first || arg >= 16 {
+			return fmt.Errorf("app argument %d out of range [%d, 16)", arg, first)
+		}
+	}
+	if proofArg == publicInputsArg {
+		return fmt.Errorf("proof and public inputs must be different app arguments")
+	}
+	return nil
+}
+
 // encodeARC4 encodes a proof or public inputs into the ABI format expected by the verifiers
 func encodeARC4(input [][]byte) ([]byte, error) {
 	arcType, err := abi.TypeOf("byte[32][]")
@@ -57,10 +57,11 @@ func testVkWithCommitments(t *testing.T, curve ecc.ID, nbCommitments int,
 	return vk
 }
 
-func renderVerifier(t *testing.T, vk plonk.VerifyingKey, ct ContractType) string {
+func renderVerifier(t *testing.T, vk plonk.VerifyingKey, ct ContractType,
+	opts ...Option) string {
 	t.Helper()
 	var buf bytes.Buffer
-	if err := WritePythonCode(vk, ct, &buf); err != nil {
+	if err := WritePythonCode(vk, ct, &buf, opts...); err != nil {
 		t.Fatalf("rendering verifier: %v", err)
 	}
 	return buf.String()
@@ -71,7 +72,7 @@ func renderVerifier(t *testing.T, vk plonk.VerifyingKey, ct ContractType) string
 func TestTemplatesWithoutCommitments(t *testing.T) {
 	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
 		vk := testVkWithCommitments(t, curve, 0)
-		for _, ct := range []ContractType{LogicSig, SmartContract} {
+		for _, ct := range []ContractType{LogicSig, SmartContract, Subroutine} {
 			code := renderVerifier(t, vk, ct)
 			for _, marker := range []string{"QCP", "BSB_COM", "hash_fr"} {
 				if strings.Contains(code, marker) {
@@ -106,8 +107,9 @@ func TestTemplatesWithCommitments(t *testing.T) {
 				"+ beta_pre + BSB_COM_0 + GRAND_PRODUCT",
 				"+ VK_S1 + VK_S2 + VK_QCP_0 + linearized_poly_at_z_bytes",
 				"+ S2_AT_Z + QCP_0_AT_Z + GRAND_PRODUCT_AT_Z_OMEGA",
-				"ec.scalar_mul(EC.BN254g1, BSB_COM_0, QCP_0_AT_Z)",
-				"ec.scalar_mul(EC.BN254g1, VK_QCP_0, r_acc.bytes)",
+				"VK_QK + BSB_COM_0\n",
+				"UInt256(1).bytes + QCP_0_AT_Z\n",
+				"+ VK_S2 + VK_QCP_0,",
 				"def hash_fr(p: Bytes) -> BigUInt:",
 			},
 			dontWant: []string{"QCP_1", "BSB_COM_1"},
@@ -149,8 +151,9 @@ func TestTemplatesWithCommitments(t *testing.T) {
 				"+ VK_S1_fs + VK_S2_fs + VK_QCP_0_fs",
 				"+ S2_AT_Z + QCP_0_AT_Z",
 				"hash_fr(fs(BSB_COM_0))",
-				"ec.scalar_mul(EC.BLS12_381g1, BSB_COM_0, QCP_0_AT_Z)",
-				"ec.scalar_mul(EC.BLS12_381g1, VK_QCP_0, r_acc.bytes)",
+				"VK_QK + BSB_COM_0\n",
+				"UInt256(1).bytes + QCP_0_AT_Z\n",
+				"+ VK_S2 + VK_QCP_0,",
 				"def hash_fr(p: Bytes) -> BigUInt:",
 			},
 		},
@@ -0,0 +1,143 @@
+package verifier
+
+import (
+	"github.com/consensys/gnark/backend/plonk"
+	plonk_bls12381 "github.com/consensys/gnark/backend/plonk/bls12-381"
+)
+
+// appCallBudget is the opcode budget each app call adds to a transaction group
+const appCallBudget = 700
+
+// opUpCallBudget is the opcode budget an op-up inner app call adds net of
+// the opcodes spent to issue it: 700 less an allowance of 20 for the loop of
+// py.ensure_budget issuing the call. The allowance is not measured; it is
+// covered by TestSmartContractVerifierWithOpUp in the testutils package,
+// which pays OpUpFee with no extra budget.
+const opUpCallBudget = 680
+
+// budgetEstimate holds the opcode budget a verifier consumes on a curve, as
+// upper bounds checked against simulation by the op-up integration tests of
+// the testutils package
+type budgetEstimate struct {
+	base          int // verifier without BSB22 commitments, up to 4 public inputs
+	perCommitment int // each BSB22 commitment
+	subgroupCheck int // each ec_subgroup_check with WithSubgroupChecks
+}
+
+// The base and per-commitment budgets are not measured. They are the README
+// table, 93,000 and 120,000 without commitments and steps of 12,000 to 15,000
+// and 16,000 to 17,000 per commitment, rounded up by about 8%. That table is
+// checked within 5% by TestSmartContractVerifierOpcodeBudget in the testutils
+// package, which logs the measured budgets. The subgroup check budgets are the
+// AVM costs of ec_subgroup_check on BN254g1 and BLS12_381g1.
+var (
+	budgetBn254     = budgetEstimate{base: 100_000, perCommitment: 16_000, subgroupCheck: 20}
+	budgetBls12_381 = budgetEstimate{base: 130_000, perCommitment: 17_000, subgroupCheck: 1_850}
+)
+
+// budgetLoopedPublicInputs is the extra opcode budget of the loops used to
+// interpolate more than maxUnrolledPublicInputs public inputs, and
+// budgetPerPublicInput the budget of each of those public inputs. Both are
+// unmeasured allowances: no integration test yet simulates a verifier with
+// more than maxUnrolledPublicInputs public inputs.
+const (
+	budgetLoopedPublicInputs = 20_000
+	budgetPerPublicInput     = 1_000
+)
+
+// budgetMiMCPerInput is the opcode budget of hashing each public input with the
+// mimc opcode with WithHashedPublicInputs: the AVM cost of 550 per 32 bytes,
+// plus an unmeasured allowance of 50 for the fixed cost and the handling of
+// the digest
+const budgetMiMCPerInput = 600
+
+// budgetNullifier, budgetStateRoot and budgetVerifiedEvent are the opcode
+// budget of spending the nullifier, moving to the new state root and emitting
+// the verified event after verifying a valid proof. They are unmeasured
+// allowances, several times the few dozen opcodes of the generated code. The
+// nullifier and event budgets are covered by TestSmartContractVerifierWithOpUp
+// in the testutils package.
+const (
+	budgetNullifier     = 100
+	budgetStateRoot     = 100
+	budgetVerifiedEvent = 200
+)
+
+// budgetDomainSeparation is the opcode budget of checking the genesis hash and
+// app ID public inputs with WithDomainSeparation, budgetFailureReasons the
+// budget of the `verify_with_reason` call and of the reason checks replacing
+// the assertions with WithFailureReasons, and budgetBoxInputs the budget
+// `verify_uploaded` spends with WithBoxInputs to read and delete the upload
+// box, rebuild the proof and public inputs and refund the deposit, before
+// calling `verify`. They are unmeasured allowances, several times the few
+// dozen opcodes of the generated code. The failure reasons budget is covered
+// by TestSmartContractVerifierWithOpUp in the testutils package.
+const (
+	budgetDomainSeparation = 100
+	budgetFailureReasons   = 100
+	budgetBoxInputs        = 300
+)
+
+// EstimateOpcodeBudget returns an upper bound of the opcode budget consumed by
+// the verifier generated for `vk` with `opts`, which verifiers generated with
+// WithOpUp raise their budget to.
+// The estimate is generous since a verification running out of budget fails,
+// WithNativeModExp verifiers in particular consume much less.
+func EstimateOpcodeBudget(vk plonk.VerifyingKey, opts ...Option) (int, error) {
+	nbPublicInputs, nbCommitments, err := vkDimensions(vk)
+	if err != nil {
+		return 0, err
+	}
+	est := budgetBn254
+	if _, ok := vk.(*plonk_bls12381.VerifyingKey); ok {
+		est = budgetBls12_381
+	}
+	budget := est.base + nbCommitments*est.perCommitment
+	if !templateUnrolled(nbPublicInputs) {
+		budget += budgetLoopedPublicInputs + nbPublicInputs*budgetPerPublicInput
+	}
+	o := newOptions(opts)
+	budget += o.HashedPublicInputs * budgetMiMCPerInput
+	if o.Nullifier {
+		budget += budgetNullifier
+	}
+	if o.StateRoot {
+		budget += budgetStateRoot
+	}
+	if o.VerifiedEvent {
+		budget += budgetVerifiedEvent
+	}
+	if o.DomainSeparation {
+		budget += budgetDomainSeparation
+	}
+	if o.FailureReasons {
+		budget += budgetFailureReasons
+	}
+	if o.BoxInputs {
+		budget += budgetBoxInputs
+	}
+	if o.SubgroupChecks {
+		// the 9 G1 points of the proof and the BSB22 commitments
+		budget += (9 + nbCommitments) * est.subgroupCheck
+	}
+	return budget, nil
+}
+
+// OpUpFee returns the fee, in microalgos, to pay on the app call to a verifier
+// generated for `vk` with WithOpUp and `opts`, given the minimum transaction
+// fee `minFee`. It covers the call and the inner app calls the verifier issues
+// when it is the only app call of the group, and with WithBoxInputs the inner
+// payment refunding the deposit of `verify_uploaded`. Fees paid in excess are
+// not refunded.
+func OpUpFee(vk plonk.VerifyingKey, minFee uint64, opts ...Option) (uint64, error) {
+	budget, err := EstimateOpcodeBudget(vk, opts...)
+	if err != nil {
+		return 0, err
+	}
+	innerTxns := 0
+	if newOptions(opts).BoxInputs {
+		innerTxns++
+	}
+	innerTxns += (budget - appCallBudget + opUpCallBudget - 1) / opUpCallBudget
+	return minFee * uint64(1+innerTxns), nil
+}
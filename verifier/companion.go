@@ -0,0 +1,61 @@
+package verifier
+
+import (
+	"io"
+	"text/template"
+
+	"github.com/consensys/gnark/backend/plonk"
+)
+
+// companionData is the data a Companion module is generated from
+type companionData struct {
+	// Address is the address of the trusted logicsig verifier
+	Address string
+	// ProofLength and NbPublicInputs are the number of 32-byte values of the
+	// proofs and public inputs the logicsig verifier reads
+	ProofLength    int
+	NbPublicInputs int
+	// GroupArgs is set if the logicsig verifier reads the proof and public
+	// inputs from the app arguments ProofArg and PublicInputsArg of the app
+	// call at position GroupIndex, instead of the arguments 1 and 2 of the app
+	// call it signs
+	GroupArgs       bool
+	GroupIndex      int
+	ProofArg        int
+	PublicInputsArg int
+	// ArgsTxn is the name of the app call holding the proof and public
+	// inputs, and NbAppArgs the number of its app arguments the verifier reads
+	ArgsTxn   string
+	NbAppArgs int
+}
+
+// writeCompanion writes a Companion module for the logicsig verifier of `vk`,
+// taking `nbPublicInputs` public inputs, whose address is set in `o`
+func writeCompanion(vk plonk.VerifyingKey, nbPublicInputs int, o *options,
+	w io.Writer) error {
+	proofLength, err := proofLength(vk)
+	if err != nil {
+		return err
+	}
+	data := companionData{
+		Address:         o.LogicSigAddress,
+		ProofLength:     proofLength,
+		NbPublicInputs:  nbPublicInputs,
+		ProofArg:        1,
+		PublicInputsArg: 2,
+		ArgsTxn:         "txn",
+	}
+	if o.GroupArgs {
+		data.GroupArgs = true
+		data.GroupIndex = o.GroupIndex
+		data.ProofArg = o.ProofArg
+		data.PublicInputsArg = o.PublicInputsArg
+		data.ArgsTxn = "args_txn"
+	}
+	data.NbAppArgs = max(data.ProofArg, data.PublicInputsArg) + 1
+	t, err := template.New("t").Parse(tmplCompanion)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
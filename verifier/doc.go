@@ -1,11 +1,14 @@
 /*
-package verifier provides functions to generate either a verifier logicsig or
-verifier smart contract from a compiled circuit.
+package verifier provides functions to generate a verifier logicsig, a verifier
+smart contract, a verifier subroutine module or a logicsig verifier companion module
+from a compiled circuit.
 
 If logicsig generation is chosen, the generated logicsig will look for its arguments
 (proof and public inputs) in the first two elements of the transaction's application
 arguments. This the verifier logicsig has to be used to sign an application call
 transaction.
+WithGroupArgs makes it read them from the arguments of another app call of its
+group instead.
 
 If smart contract generation is chosen, the generated contract will be an ARC4
 contract with the following ABI methods:
@@ -35,5 +38,64 @@ and returns `True` if the proof is verifier, `False` otherwise
 
 	@abimethod
 	def verify(self, proof: ..., public_inputs: ...) -> arc4.Bool:
+
+If subroutine module generation is chosen, the generated module will expose a
+subroutine that Algorand Python contracts can import to verify proofs inline,
+with the other module level names prefixed with `_verifier_`
+
+	@subroutine
+	def verify_proof(proof: ..., public_inputs: ...) -> bool:
+
+If companion module generation is chosen, with the WithLogicSigProgram option,
+the generated module will expose a subroutine that Algorand Python contracts can
+import to check that an app call of their group is signed by the logicsig
+verifier and read the public inputs of its proof
+
+	@subroutine
+	def verified_public_inputs(group_index: UInt64) -> DynamicArray[Bytes32]:
+
+WriteUniversalPythonCode generates instead a universal smart contract verifier,
+which verifies proofs of any circuit for a curve with the verifying keys its
+creator registers in box storage
+
+	@abimethod
+	def verify(self, vk_hash: Bytes32, proof: ..., public_inputs: ...) -> arc4.Bool:
+
+WriteMultiPythonCode generates a smart contract verifier for several circuits,
+with a method for each of them sharing the verification code
+
+	@abimethod
+	def verify_<name>(self, proof: ..., public_inputs: ...) -> arc4.Bool:
+
+The generated code can be customized passing options to WritePythonCode:
+  - WithSubgroupChecks to check that all proof points are in the prime-order subgroup
+  - WithNativeModExp to use the AVM bmodexp opcode
+  - WithAVMVersion to target a specific AVM version
+  - WithResumableVerification to split a smart contract verification across two
+    app calls
+  - WithOpUp to make a smart contract verifier raise its own opcode budget
+  - WithPostVerifyHook to make a smart contract verifier act on valid proofs
+  - WithNullifier to make a smart contract verifier accept each nullifier only once
+  - WithTxnBinding to make a logicsig verifier bind public inputs to fields of the
+    transaction it signs
+  - WithStateRoot to make a smart contract verifier accept proven transitions of
+    a state root
+  - WithBoxInputs to make a smart contract verifier read proofs and public
+    inputs uploaded to box storage
+  - WithDomainSeparation to make a smart contract verifier accept only proofs
+    bound to its network and app ID
+  - WithHashedPublicInputs to verify proofs of circuits wrapped with
+    algoplonk.HashedPublicInputs against the hash of the public inputs
+  - WithEscrow to make a logicsig verifier an escrow account signing payments and
+    asset transfers, with WithCloseTo and WithRekey to relax its constraints
+  - WithGroupArgs to make a logicsig verifier read the proof from another app
+    call of its group
+  - WithVerifiedEvent to make a smart contract verifier emit an ARC-28 event
+    for each valid proof
+  - WithTypedPublicInputs to make the verify method of a smart contract verifier
+    take the named public fields of the circuit
+  - WithFailureReasons to make a verifier report why it rejects a proof
+  - WithMaxFee and WithLease to set the fee limit of a logicsig verifier and
+    require a lease
 */
 package verifier
@@ -0,0 +1,64 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/consensys/gnark/backend/plonk"
+)
+
+// VerifiedEventSignature is the ARC-28 signature of the event a smart contract
+// verifier generated with WithVerifiedEvent emits for each valid proof, with
+// the hash of its verifying key and the hash of the public inputs
+const VerifiedEventSignature = "ProofVerified(byte[32],byte[32])"
+
+// VerifiedEventWithPublicInputsSignature is the ARC-28 signature of the event
+// emitted instead by verifiers generated with WithVerifiedEvent(true), adding
+// the public inputs
+const VerifiedEventWithPublicInputsSignature = "ProofVerified(byte[32],byte[32],byte[32][])"
+
+// maxLogSize is the largest total size in bytes of the logs of an app call,
+// which include the events and the ABI return value
+const maxLogSize = 1024
+
+// VerifyingKeyHash returns the SHA-256 hash of `vk` serialized with its WriteTo
+// method, e.g., of a verifying key file written by gnark, which identifies the
+// circuit in the events of verifiers generated with WithVerifiedEvent
+func VerifyingKeyHash(vk plonk.VerifyingKey) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := vk.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("error serializing verifying key: %v", err)
+	}
+	h := sha256.Sum256(buf.Bytes())
+	return h[:], nil
+}
+
+// verifiedEventSize returns the size in bytes of the log of the event emitted
+// by a verifier generated with `o` for `nbPublicInputs` public inputs: the
+// event selector, the two hashes and, if included, the offset, length and
+// values of the public inputs
+func verifiedEventSize(o *options, nbPublicInputs int) int {
+	size := 4 + 32 + 32
+	if o.VerifiedEventPublicInputs {
+		size += 2 + 2 + 32*nbPublicInputs
+	}
+	return size
+}
+
+// checkLogSize returns an error if the logs of a verify call of a verifier
+// generated with `o` for `nbPublicInputs` public inputs can exceed maxLogSize:
+// the verified event, the state transition event of WithStateRoot and the ABI
+// return value, a 4-byte prefix and one byte. Logs of a post-verify hook are
+// not accounted for
+func checkLogSize(o *options, nbPublicInputs int) error {
+	size := verifiedEventSize(o, nbPublicInputs) + 4 + 1
+	if o.StateRoot {
+		size += 4 + 32 + 32
+	}
+	if size > maxLogSize {
+		return fmt.Errorf("verified event of %d public inputs exceeds the %d "+
+			"bytes an app call can log", nbPublicInputs, maxLogSize)
+	}
+	return nil
+}
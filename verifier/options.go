@@ -0,0 +1,640 @@
+package verifier
+
+import (
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/consensys/gnark/frontend"
+)
+
+// Option configures the verifier generated by WritePythonCode
+type Option func(*options)
+
+// options holds the code generation settings selected with Option values.
+// The fields are exported so that the templates can read them.
+type options struct {
+	// SubgroupChecks makes the verifier check that every G1 point of the proof
+	// is on the curve and in the prime-order subgroup before using it
+	SubgroupChecks bool
+	// NativeModExp makes the verifier compute modular exponentiations with the
+	// AVM bmodexp opcode instead of a windowed square and multiply subroutine
+	NativeModExp bool
+	// AVMVersion is the AVM version targeted by the verifier, 0 if the
+	// compiler default is used
+	AVMVersion int
+	// Resumable makes a smart contract verifier split the verification in two
+	// app calls, saving the progress in box storage
+	Resumable bool
+	// OpUp makes a smart contract verifier raise its own opcode budget with
+	// inner app calls
+	OpUp bool
+	// PostVerifyHook is the body of the method a smart contract verifier runs
+	// after verifying a valid proof
+	PostVerifyHook string
+	// Nullifier makes a smart contract verifier accept each value of the
+	// public input at NullifierIndex only once
+	Nullifier      bool
+	NullifierIndex int
+	// StateRoot makes a smart contract verifier keep a state root, accepting
+	// proofs whose public input at OldRootIndex is the current root and
+	// replacing it with the public input at NewRootIndex
+	StateRoot    bool
+	OldRootIndex int
+	NewRootIndex int
+	// TxnBindings are the public inputs a logicsig verifier binds to fields of
+	// the transaction it signs
+	TxnBindings []TxnBinding
+	// Escrow makes a logicsig verifier read the proof and public inputs from
+	// its arguments and sign payments and asset transfers
+	Escrow bool
+	// MaxFee is the highest fee, in microalgos, of the transactions a logicsig
+	// verifier signs
+	MaxFee uint64
+	// Lease makes a logicsig verifier require the transactions it signs to
+	// have a lease
+	Lease bool
+	// DomainSeparation makes a smart contract verifier check that the public
+	// inputs at GenesisHashIndex and GenesisHashIndex+1 are the high and low
+	// 128 bits of the genesis hash of the network, and the one at AppIDIndex
+	// the ID of the verifier app
+	DomainSeparation bool
+	GenesisHashIndex int
+	AppIDIndex       int
+	// HashedPublicInputs is the number of public inputs hashed into the only
+	// public input of a circuit wrapped with algoplonk.HashedPublicInputs, or
+	// zero if the public inputs are not hashed
+	HashedPublicInputs int
+	// BoxInputs makes a smart contract verifier read the proof and public
+	// inputs from a box the caller uploads them to
+	BoxInputs bool
+	// GroupArgs makes a logicsig verifier read the proof and public inputs
+	// from the app arguments at positions ProofArg and PublicInputsArg of the
+	// app call at position GroupIndex of its group
+	GroupArgs       bool
+	GroupIndex      int
+	ProofArg        int
+	PublicInputsArg int
+	// FailureReasons makes a smart contract verifier return the reason a
+	// proof fails verification, and a logicsig verifier fail with it
+	FailureReasons bool
+	// VerifiedEvent makes a smart contract verifier emit an event for each
+	// valid proof, including the public inputs if VerifiedEventPublicInputs
+	VerifiedEvent             bool
+	VerifiedEventPublicInputs bool
+	// TypedPublicInputs is the circuit whose public fields are the arguments
+	// of the `verify` method of a smart contract verifier, or nil if `verify`
+	// takes the public inputs as an array
+	TypedPublicInputs frontend.Circuit
+	// LogicSigAddress is the address of the logicsig verifier a companion
+	// module trusts
+	LogicSigAddress string
+	// AllowCloseTo and AllowRekey let an escrow logicsig verifier sign
+	// transactions closing or rekeying its account
+	AllowCloseTo bool
+	AllowRekey   bool
+}
+
+// maxGroupSize and maxAppArgs are the largest number of transactions of a
+// group and of arguments of an app call
+const (
+	maxGroupSize = 16
+	maxAppArgs   = 16
+)
+
+// avmFeature is an AVM capability generated verifiers can rely on, with the
+// first AVM version providing it
+type avmFeature struct {
+	name    string
+	version int
+}
+
+var (
+	// featureMultiScalarMul covers ec_multi_scalar_mul and the other elliptic
+	// curve opcodes every verifier uses
+	featureMultiScalarMul = avmFeature{"elliptic curve opcodes", 10}
+	// featureModExp is the bmodexp opcode used by WithNativeModExp
+	featureModExp = avmFeature{"bmodexp", 12}
+	// featureMiMC is the mimc opcode used by WithHashedPublicInputs
+	featureMiMC = avmFeature{"mimc", 11}
+	// featureBoxes covers the box storage opcodes
+	featureBoxes = avmFeature{"box storage", 8}
+)
+
+// newOptions returns the options resulting from applying opts in order
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// resolve checks that the options are compatible with a verifier of type
+// outputType and that the features they need are available on the target
+// AVM version, if one was set, and then turns on the optional features that
+// the version provides
+func (o *options) resolve(outputType ContractType) error {
+	if o.Resumable && outputType != SmartContract {
+		return fmt.Errorf("resumable verification requires a smart contract verifier")
+	}
+	if o.OpUp && outputType != SmartContract {
+		return fmt.Errorf("op-up requires a smart contract verifier")
+	}
+	if o.PostVerifyHook != "" && outputType != SmartContract {
+		return fmt.Errorf("post-verify hooks require a smart contract verifier")
+	}
+	if o.Nullifier && outputType != SmartContract {
+		return fmt.Errorf("nullifiers require a smart contract verifier")
+	}
+	if o.StateRoot && outputType != SmartContract {
+		return fmt.Errorf("state roots require a smart contract verifier")
+	}
+	if o.VerifiedEvent && outputType != SmartContract {
+		return fmt.Errorf("verified events require a smart contract verifier")
+	}
+	if o.TypedPublicInputs != nil && outputType != SmartContract {
+		return fmt.Errorf("typed public inputs require a smart contract verifier")
+	}
+	if o.DomainSeparation && outputType != SmartContract {
+		return fmt.Errorf("domain separation requires a smart contract verifier")
+	}
+	if o.DomainSeparation && (o.AppIDIndex == o.GenesisHashIndex ||
+		o.AppIDIndex == o.GenesisHashIndex+1) {
+		return fmt.Errorf("genesis hash and app ID must be different public inputs")
+	}
+	if o.StateRoot && o.OldRootIndex == o.NewRootIndex {
+		return fmt.Errorf("old and new state roots must be different public inputs")
+	}
+	if len(o.TxnBindings) > 0 && outputType != LogicSig {
+		return fmt.Errorf("transaction bindings require a logicsig verifier")
+	}
+	for _, b := range o.TxnBindings {
+		if _, ok := txnFieldExpr[b.Field]; !ok {
+			return fmt.Errorf("unknown transaction field %d", b.Field)
+		}
+		if b.Field == TxnGroupID && (!o.Escrow || o.GroupArgs) {
+			return fmt.Errorf("binding the group ID requires an escrow logicsig " +
+				"verifier reading its own arguments, since the group ID covers " +
+				"the application arguments")
+		}
+	}
+	if o.Escrow && outputType != LogicSig {
+		return fmt.Errorf("escrow requires a logicsig verifier")
+	}
+	if (o.MaxFee > 0 || o.Lease) && outputType != LogicSig {
+		return fmt.Errorf("fee and lease constraints require a logicsig verifier")
+	}
+	if (o.AllowCloseTo || o.AllowRekey) && !o.Escrow {
+		return fmt.Errorf("close-to and rekey constraints require an " +
+			"escrow logicsig verifier")
+	}
+	if o.GroupArgs && outputType != LogicSig && outputType != Companion {
+		return fmt.Errorf("group arguments require a logicsig verifier")
+	}
+	if o.GroupArgs && (o.GroupIndex < 0 || o.GroupIndex >= maxGroupSize) {
+		return fmt.Errorf("group index %d out of range for groups of %d "+
+			"transactions", o.GroupIndex, maxGroupSize)
+	}
+	for _, arg := range []int{o.ProofArg, o.PublicInputsArg} {
+		if o.GroupArgs && (arg < 0 || arg >= maxAppArgs) {
+			return fmt.Errorf("app argument %d out of range for %d app arguments",
+				arg, maxAppArgs)
+		}
+	}
+	if o.GroupArgs && o.ProofArg == o.PublicInputsArg {
+		return fmt.Errorf("proof and public inputs must be different app arguments")
+	}
+	if o.GroupArgs && o.AllowRekey {
+		return fmt.Errorf("rekey cannot be combined with group arguments, since " +
+			"companion modules trust that only the logicsig verifier signs " +
+			"for its address")
+	}
+	if o.FailureReasons && outputType != SmartContract && outputType != LogicSig {
+		return fmt.Errorf("failure reasons require a smart contract or logicsig verifier")
+	}
+	if o.FailureReasons && o.Resumable {
+		return fmt.Errorf("failure reasons cannot be combined with resumable verification")
+	}
+	if o.HashedPublicInputs < 0 {
+		return fmt.Errorf("negative number of hashed public inputs")
+	}
+	if o.BoxInputs && outputType != SmartContract {
+		return fmt.Errorf("box inputs require a smart contract verifier")
+	}
+	if o.BoxInputs && o.Resumable {
+		return fmt.Errorf("box inputs cannot be combined with resumable verification")
+	}
+	if o.TypedPublicInputs != nil && o.Resumable {
+		return fmt.Errorf("typed public inputs cannot be combined with " +
+			"resumable verification")
+	}
+	if o.TypedPublicInputs != nil && o.FailureReasons {
+		return fmt.Errorf("typed public inputs cannot be combined with " +
+			"failure reasons")
+	}
+	if o.TypedPublicInputs != nil && o.HashedPublicInputs > 0 {
+		return fmt.Errorf("typed public inputs cannot be combined with " +
+			"hashed public inputs")
+	}
+	if o.OpUp && o.Resumable {
+		return fmt.Errorf("op-up cannot be combined with resumable verification")
+	}
+	if o.OpUp && o.PostVerifyHook != "" {
+		return fmt.Errorf("op-up cannot be combined with a post-verify hook, " +
+			"whose opcode budget cannot be estimated")
+	}
+	if (o.LogicSigAddress != "") != (outputType == Companion) {
+		return fmt.Errorf("companion modules require, and only companion " +
+			"modules accept, the logicsig verifier program")
+	}
+	if o.AVMVersion == 0 {
+		return nil
+	}
+	required := []avmFeature{featureMultiScalarMul}
+	if o.Resumable || o.Nullifier || o.BoxInputs {
+		required = append(required, featureBoxes)
+	}
+	if o.NativeModExp {
+		required = append(required, featureModExp)
+	}
+	if o.HashedPublicInputs > 0 {
+		required = append(required, featureMiMC)
+	}
+	for _, f := range required {
+		if err := o.require(f); err != nil {
+			return err
+		}
+	}
+	if o.supports(featureModExp) {
+		o.NativeModExp = true
+	}
+	return nil
+}
+
+// supports reports whether the target AVM version provides feature f
+func (o *options) supports(f avmFeature) bool {
+	return o.AVMVersion == 0 || o.AVMVersion >= f.version
+}
+
+// require returns an error if the target AVM version does not provide
+// feature f
+func (o *options) require(f avmFeature) error {
+	if !o.supports(f) {
+		return fmt.Errorf("AVM version %d does not provide %s "+
+			"(available from version %d)", o.AVMVersion, f.name, f.version)
+	}
+	return nil
+}
+
+// WithSubgroupChecks makes the generated verifier run `ec_subgroup_check` on
+// every G1 point of the proof, BSB22 commitments included, before using it.
+// Points not on the curve make the verifier fail, points outside the
+// prime-order subgroup make it reject the proof.
+//
+// `ec_add` and `ec_scalar_mul` do not check subgroup membership, so this is
+// recommended for security sensitive deployments on BLS12-381, whose G1 has a
+// large cofactor. The extra opcode cost is 20 per proof point on BN254 and
+// 1,850 per proof point on BLS12-381.
+func WithSubgroupChecks() Option {
+	return func(o *options) {
+		o.SubgroupChecks = true
+	}
+}
+
+// WithNativeModExp makes the generated verifier compute modular
+// exponentiations, used for the vanishing polynomial, the field inversions and
+// the Lagrange terms, with the AVM `bmodexp` opcode.
+//
+// The target network must run an AVM version that provides `bmodexp`, 12 or
+// later, and the puyapy version used to compile the verifier must expose it as
+// `algopy.op.bmodexp`. WithAVMVersion turns it on for versions providing it.
+// Without this option the verifier uses a subroutine that processes the
+// exponent in windows of 4 bits, which runs on any AVM version.
+func WithNativeModExp() Option {
+	return func(o *options) {
+		o.NativeModExp = true
+	}
+}
+
+// WithAVMVersion makes the generated verifier target AVM version `version`,
+// which is written in the program pragma.
+//
+// The version selects the opcodes the verifier uses: versions providing
+// `bmodexp` turn on WithNativeModExp. Generating the verifier fails if
+// `version` lacks a feature the verifier needs or that was requested with
+// another option, e.g., versions before 10 lack the elliptic curve opcodes.
+// Without this option the puyapy default version is used and optional
+// features are used only when requested.
+func WithAVMVersion(version int) Option {
+	return func(o *options) {
+		o.AVMVersion = version
+	}
+}
+
+// WithResumableVerification makes a smart contract verifier split the
+// verification in two app calls, so that each fits in the opcode budget of a
+// transaction group. `verify_start` checks the proof and public inputs,
+// derives the challenges and interpolates the public inputs, saving the
+// progress in a box named "s" followed by the sha256 hash of the ABI encoded
+// proof and public inputs. `verify_finish`, called with the same arguments in
+// a later app call or group, completes the verification with the pairing
+// check and deletes the box. `delete_session` deletes the box of a session
+// started more than 1000 rounds ago and never completed.
+//
+// `verify_start` takes, before the proof, a payment of 108,500 microalgos to
+// the app account, utils.SessionDeposit, covering the minimum balance of the
+// session box, which the app refunds to the payer with an inner payment when
+// the session is deleted, or at once if the inputs are malformed; the app
+// calls deleting sessions pay the inner transaction fee. The verify methods
+// and `delete_session` need a reference to the session box.
+func WithResumableVerification() Option {
+	return func(o *options) {
+		o.Resumable = true
+	}
+}
+
+// WithOpUp makes a smart contract verifier raise its own opcode budget, so
+// that a single app call to `verify` is enough to verify a proof. Before
+// verifying, `verify` issues inner no-op app calls until the group has the
+// budget returned by EstimateOpcodeBudget, fewer if other app calls in the
+// group already provide part of it.
+//
+// The inner app calls are paid through fee pooling, so the app call to
+// `verify` must pay their fees, as returned by OpUpFee. A group can issue at
+// most 256 inner transactions, for 174,080 opcode budget (256 times 680), and
+// verifiers needing more still need extra app calls in the group.
+// It cannot be combined with WithResumableVerification, nor with
+// WithPostVerifyHook, since the budget of the hook cannot be estimated.
+func WithOpUp() Option {
+	return func(o *options) {
+		o.OpUp = true
+	}
+}
+
+// WithPostVerifyHook makes a smart contract verifier run `code` after
+// verifying a valid proof, so that a single app call both verifies the proof
+// and acts on it, e.g., updating state or sending a payment. Failing in `code`
+// fails the app call.
+//
+// `code` is the body of a subroutine method of the contract, indented with
+// either spaces or tabs, whose indentation is converted to tabs to fit:
+//
+//	@subroutine
+//	def on_verified(self, public_inputs: DynamicArray[Bytes32]) -> None:
+//
+// It can read the public inputs as arc4 values, e.g.,
+// `BigUInt.from_bytes(public_inputs[0].bytes)`, or, with
+// WithTypedPublicInputs, the public fields of the circuit, which the method
+// takes instead with the same names and types as the arguments of `verify`.
+// It can access the contract state through `self` and use the names the
+// verifier imports, e.g., `py` for the algopy module. The hook runs in
+// `verify`, or in `verify_finish` with WithResumableVerification.
+func WithPostVerifyHook(code string) Option {
+	return func(o *options) {
+		o.PostVerifyHook = code
+	}
+}
+
+// WithNullifier makes a smart contract verifier treat the public input at
+// position `index` as a nullifier, accepting each of its values only once.
+// After verifying a valid proof the verifier records its nullifier in a box
+// named "n" followed by the nullifier, and `verify` returns False for proofs
+// whose nullifier is already recorded, valid or not. The `is_spent` method
+// returns whether a nullifier is recorded.
+//
+// The calls to `verify` and `is_spent` need a reference to the nullifier box,
+// see utils.NullifierBoxName. The box is never deleted, so the transaction
+// preceding the app call spending the nullifier must be a payment to the app
+// account of the minimum balance of the box, utils.NullifierDeposit, without
+// which the call fails. The payment is kept if the proof is not valid.
+func WithNullifier(index int) Option {
+	return func(o *options) {
+		o.Nullifier = true
+		o.NullifierIndex = index
+	}
+}
+
+// WithBoxInputs makes a smart contract verifier read the proof and public
+// inputs from box storage, for proofs and public inputs exceeding the 2,048
+// bytes of app call arguments. Callers start an upload with
+// `start_upload(deposit)`, which creates a box named "u" followed by the
+// address of the sender, holding the proof followed by the public inputs, and
+// then write it over one or more app calls to `upload(offset, chunk)`, which
+// writes `chunk` at `offset` of the box. `verify_uploaded` then verifies the
+// uploaded proof for the uploaded public inputs and deletes the box, while
+// `delete_upload` deletes the box of an abandoned upload. The `verify` method
+// is unchanged.
+//
+// The deposit is a payment to the app account of the minimum balance of the
+// box, 2,500 plus 400 microalgos per byte of box name and size, so that
+// uploads do not lock the funds of the app, and both `verify_uploaded` and
+// `delete_upload` refund it to the sender with an inner payment whose fee the
+// caller pays. The app calls need references to the upload box, see
+// utils.UploadDeposit, utils.UploadBoxReferences and utils.UploadMethodArgs.
+// It cannot be combined with WithResumableVerification.
+func WithBoxInputs() Option {
+	return func(o *options) {
+		o.BoxInputs = true
+	}
+}
+
+// WithStateRoot makes a smart contract verifier accept proofs of state
+// transitions. The contract keeps a state root in global state, set on
+// creation with the `state_root` argument of `create`, and `verify` returns
+// False for proofs whose public input at position `oldRootIndex` is not the
+// current state root. After verifying a valid proof the verifier replaces the
+// state root with the public input at position `newRootIndex` and emits the
+// ARC-28 event `StateTransition(byte[32],byte[32])` with the old and new roots.
+func WithStateRoot(oldRootIndex, newRootIndex int) Option {
+	return func(o *options) {
+		o.StateRoot = true
+		o.OldRootIndex = oldRootIndex
+		o.NewRootIndex = newRootIndex
+	}
+}
+
+// WithVerifiedEvent makes a smart contract verifier emit an ARC-28 event for
+// each valid proof, so that indexers can follow the verified proofs without
+// decoding the app call arguments. The event, VerifiedEventSignature, holds
+// the VerifyingKeyHash of the verifier and the SHA-256 hash of the public
+// inputs, as exported by AlgoPlonk; with `includePublicInputs` it also holds
+// the public inputs themselves, VerifiedEventWithPublicInputsSignature.
+// utils.DecodeVerifiedEvent decodes it from the logs of the app call.
+//
+// An app call logs at most 1,024 bytes, so the public inputs can be included
+// for up to 29 of them, 27 with WithStateRoot.
+func WithVerifiedEvent(includePublicInputs bool) Option {
+	return func(o *options) {
+		o.VerifiedEvent = true
+		o.VerifiedEventPublicInputs = includePublicInputs
+	}
+}
+
+// WithTypedPublicInputs makes the `verify` method of a smart contract verifier
+// take the public fields of `circuit` as arguments, after the proof, instead of
+// an array of public inputs, so that the ABI of the verifier, e.g., its ARC-56
+// JSON, documents the meaning of the inputs. PublicFields lists the arguments:
+// a uint256 for each public variable and a static array of uint256, e.g.,
+// uint256[3], for each public array, named after the field in snake case.
+// utils.TypedVerifyMethodArgs builds the arguments from a circuit assignment.
+//
+// `circuit` is a circuit definition with the public inputs of the verifying
+// key, e.g., the one passed to algoplonk.Compile. `verify_uploaded` of
+// WithBoxInputs is unchanged. It cannot be combined with
+// WithResumableVerification, WithFailureReasons or WithHashedPublicInputs.
+func WithTypedPublicInputs(circuit frontend.Circuit) Option {
+	return func(o *options) {
+		o.TypedPublicInputs = circuit
+	}
+}
+
+// WithTxnBinding makes a logicsig verifier require the public input at
+// position `publicInput` to match `field` of the transaction it signs, so that
+// a proof authorizes one specific transaction instead of any transaction
+// carrying it. It can be passed several times to bind several fields.
+//
+// Addresses, the group ID and the lease are 32 bytes, more than fit in a field
+// element, so they are bound to two public inputs, at positions `publicInput`
+// and `publicInput`+1, holding their high and low 128 bits. The other fields
+// match the public input if they are equal to it, or for TxnValidFrom and
+// TxnValidUntil if the round window is within it. The utils package provides
+// functions to compute the public inputs. The group ID
+// covers the application arguments, so binding it requires WithEscrow, which
+// reads the proof from the logicsig arguments instead, without WithGroupArgs.
+func WithTxnBinding(field TxnField, publicInput int) Option {
+	return func(o *options) {
+		o.TxnBindings = append(o.TxnBindings, TxnBinding{field, publicInput})
+	}
+}
+
+// WithEscrow makes a logicsig verifier an escrow account: it reads the proof
+// and public inputs from its first two logicsig arguments, instead of the
+// arguments of an app call, and signs payments and asset transfers from its
+// own account when the proof is valid, with no companion app.
+//
+// By default the signed transactions must have zero fee, paid by other
+// transactions of the group, and cannot close or rekey the account. WithMaxFee,
+// WithCloseTo and WithRekey relax these constraints. WithTxnBinding binds the
+// proof to the transaction, e.g., to its receiver and amount, without which
+// anyone holding a valid proof can sign any transaction.
+func WithEscrow() Option {
+	return func(o *options) {
+		o.Escrow = true
+	}
+}
+
+// WithMaxFee lets a logicsig verifier sign transactions with fee up to
+// `microalgos`, paid by the verifier account. By default the fee must be zero,
+// so that whoever submits a proof cannot drain the account through the fee.
+func WithMaxFee(microalgos uint64) Option {
+	return func(o *options) {
+		o.MaxFee = microalgos
+	}
+}
+
+// WithCloseTo lets an escrow logicsig verifier sign transactions closing its
+// account or one of its asset holdings. The close-to addresses should be bound
+// to public inputs with WithTxnBinding.
+func WithCloseTo() Option {
+	return func(o *options) {
+		o.AllowCloseTo = true
+	}
+}
+
+// WithRekey lets an escrow logicsig verifier sign transactions rekeying its
+// account. The rekey address should be bound to a public input with
+// WithTxnBinding. It cannot be combined with WithGroupArgs, since companion
+// modules accept the transactions of the verifier account as proven.
+func WithRekey() Option {
+	return func(o *options) {
+		o.AllowRekey = true
+	}
+}
+
+// WithLease makes a logicsig verifier require the transactions it signs to have
+// a non-zero lease, so that the ledger accepts at most one transaction with a
+// given lease from the verifier account within its validity window. Binding
+// the lease to a public input with WithTxnBinding(TxnLease, ...) makes each
+// proof usable at most once in that window.
+func WithLease() Option {
+	return func(o *options) {
+		o.Lease = true
+	}
+}
+
+// WithDomainSeparation makes a smart contract verifier reject proofs whose
+// public inputs at positions `genesisHashIndex` and `genesisHashIndex`+1 are
+// not the high and low 128 bits of the genesis hash of the network, or whose
+// public input at position `appIdIndex` is not the ID of the verifier app, so
+// that a proof is valid on one network for one deployed verifier only. Splitting
+// the hash, which may not fit in a field element, makes each network match a
+// single pair of public inputs. The circuit must declare the three public
+// inputs, and utils.Network computes their values.
+func WithDomainSeparation(genesisHashIndex, appIdIndex int) Option {
+	return func(o *options) {
+		o.DomainSeparation = true
+		o.GenesisHashIndex = genesisHashIndex
+		o.AppIDIndex = appIdIndex
+	}
+}
+
+// WithHashedPublicInputs makes the verifier take `nbInputs` public inputs and
+// hash them with the AVM mimc opcode into the digest that a circuit wrapped
+// with algoplonk.HashedPublicInputs exposes as its only public input, so that
+// the verifier cost does not grow with the number of public inputs. The
+// other options refer to the public inputs before hashing. It requires AVM
+// version 11 or later.
+func WithHashedPublicInputs(nbInputs int) Option {
+	return func(o *options) {
+		o.HashedPublicInputs = nbInputs
+	}
+}
+
+// WithGroupArgs makes a logicsig verifier read the proof and public inputs
+// from another transaction of its group, instead of the arguments 1 and 2 of
+// the app call it signs or, with WithEscrow, its logicsig arguments: the app
+// arguments at positions `proofArg` and `publicInputsArg` of the app call at
+// position `groupIndex`, e.g., an app call to the contract acting on the
+// proof, ABI encoded as by utils.ProofAndPublicInputsMethodArgs. The
+// constraints on the transactions the logicsig verifier signs are unchanged.
+//
+// Companion modules generated with the option read the public inputs from the
+// same arguments. WithTxnBinding cannot bind the group ID, which covers the
+// arguments of every transaction of the group.
+func WithGroupArgs(groupIndex, proofArg, publicInputsArg int) Option {
+	return func(o *options) {
+		o.GroupArgs = true
+		o.GroupIndex = groupIndex
+		o.ProofArg = proofArg
+		o.PublicInputsArg = publicInputsArg
+	}
+}
+
+// WithFailureReasons makes a verifier report why it rejects a proof, as a
+// FailureReason. A smart contract verifier gets a `verify_with_reason` method,
+// taking the same arguments as `verify` and returning the reason as an
+// arc4.UInt8, Verified if the proof is valid, with `verify` returning whether
+// it returns Verified; both return MalformedInput instead of failing for proofs
+// and public inputs of the wrong length. A logicsig verifier fails with an
+// assert, whose message in the TEAL program is the name of the reason, for
+// every rejection, so that utils.LogicSigFailureReason recovers the reason
+// from the program counter of a failed simulation.
+//
+// Verifiers still fail without a reason on proof points the elliptic curve
+// opcodes reject. It cannot be combined with WithResumableVerification.
+func WithFailureReasons() Option {
+	return func(o *options) {
+		o.FailureReasons = true
+	}
+}
+
+// WithLogicSigProgram sets the compiled program of the logicsig verifier that
+// a Companion module trusts, from which it computes the verifier address. The
+// logicsig verifier must not be generated with WithEscrow, since apps cannot
+// read the arguments of a logicsig, unless it reads the proof from another
+// transaction with WithGroupArgs, also passed to the Companion module.
+func WithLogicSigProgram(program []byte) Option {
+	return func(o *options) {
+		o.LogicSigAddress = crypto.AddressFromProgram(program).String()
+	}
+}
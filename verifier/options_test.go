@@ -0,0 +1,1018 @@
+package verifier
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+)
+
+// TestSubgroupChecks verifies that WithSubgroupChecks makes the verifiers
+// check every G1 point of the proof, BSB22 commitments included, and that
+// no check is generated by default.
+func TestSubgroupChecks(t *testing.T) {
+	groups := map[ecc.ID]string{ecc.BN254: "BN254g1", ecc.BLS12_381: "BLS12_381g1"}
+	points := []string{"L_COM", "R_COM", "O_COM", "H_0", "H_1", "H_2",
+		"GRAND_PRODUCT", "BATCH_OPENING_AT_Z", "OPENING_AT_Z_OMEGA", "BSB_COM_0"}
+
+	for curve, group := range groups {
+		vk := testVkWithCommitments(t, curve, 1)
+		for _, ct := range []ContractType{LogicSig, SmartContract} {
+			t.Run(fmt.Sprintf("%s-%v", curve, ct), func(t *testing.T) {
+				code := renderVerifier(t, vk, ct)
+				if strings.Contains(code, "subgroup_check") {
+					t.Errorf("unexpected subgroup check without option")
+				}
+				code = renderVerifier(t, vk, ct, WithSubgroupChecks())
+				for _, p := range points {
+					check := fmt.Sprintf("ec.subgroup_check(EC.%s, %s)", group, p)
+					if !strings.Contains(code, check) {
+						t.Errorf("missing %q in generated code", check)
+					}
+				}
+				if n := strings.Count(code, "ec.subgroup_check("); n != len(points) {
+					t.Errorf("expected %d subgroup checks, got %d", len(points), n)
+				}
+			})
+		}
+	}
+}
+
+// TestNativeModExp verifies that WithNativeModExp replaces the windowed
+// expmod subroutine with the bmodexp opcode.
+func TestNativeModExp(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithCommitments(t, curve, 1)
+		for _, ct := range []ContractType{LogicSig, SmartContract} {
+			t.Run(fmt.Sprintf("%s-%v", curve, ct), func(t *testing.T) {
+				code := renderVerifier(t, vk, ct)
+				if strings.Contains(code, "bmodexp") {
+					t.Errorf("unexpected bmodexp without option")
+				}
+				if !strings.Contains(code, "window = getbyte(e, i // 2)") {
+					t.Errorf("missing windowed expmod in generated code")
+				}
+				code = renderVerifier(t, vk, ct, WithNativeModExp())
+				if !strings.Contains(code, "bmodexp(base.bytes, exponent.bytes, modulus.bytes)") {
+					t.Errorf("missing bmodexp in generated code")
+				}
+				if strings.Contains(code, "getbyte") {
+					t.Errorf("unexpected windowed expmod with option")
+				}
+			})
+		}
+	}
+}
+
+// TestAVMVersion verifies that WithAVMVersion sets the program pragma, turns
+// on the features the version provides and rejects versions lacking a needed
+// or requested feature.
+func TestAVMVersion(t *testing.T) {
+	pragmas := map[ContractType]string{
+		LogicSig:      `@logicsig(name="Verifier", avm_version=%d)`,
+		SmartContract: `class Verifier(py.ARC4Contract, avm_version=%d):`,
+	}
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithCommitments(t, curve, 0)
+		for ct, pragma := range pragmas {
+			t.Run(fmt.Sprintf("%s-%v", curve, ct), func(t *testing.T) {
+				code := renderVerifier(t, vk, ct)
+				if strings.Contains(code, "avm_version") {
+					t.Errorf("unexpected avm_version without option")
+				}
+
+				code = renderVerifier(t, vk, ct, WithAVMVersion(10))
+				if !strings.Contains(code, fmt.Sprintf(pragma, 10)) {
+					t.Errorf("missing AVM version 10 in generated code")
+				}
+				if strings.Contains(code, "bmodexp") {
+					t.Errorf("unexpected bmodexp on AVM version 10")
+				}
+
+				code = renderVerifier(t, vk, ct, WithAVMVersion(featureModExp.version))
+				if !strings.Contains(code, fmt.Sprintf(pragma, featureModExp.version)) {
+					t.Errorf("missing AVM version %d in generated code",
+						featureModExp.version)
+				}
+				if !strings.Contains(code, "bmodexp(") {
+					t.Errorf("bmodexp not used on AVM version %d",
+						featureModExp.version)
+				}
+
+				var buf bytes.Buffer
+				err := WritePythonCode(vk, ct, &buf, WithAVMVersion(9))
+				if err == nil || !strings.Contains(err.Error(), "elliptic curve") {
+					t.Errorf("expected elliptic curve opcodes error, got %v", err)
+				}
+				err = WritePythonCode(vk, ct, &buf, WithAVMVersion(10),
+					WithNativeModExp())
+				if err == nil || !strings.Contains(err.Error(), "bmodexp") {
+					t.Errorf("expected bmodexp error, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+// TestResumableVerification tests that WithResumableVerification adds sessions.
+func TestResumableVerification(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithCommitments(t, curve, 1)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			for _, s := range []string{"BoxMap", "verify_start", "verify_finish",
+				"delete_session"} {
+				if strings.Contains(code, s) {
+					t.Errorf("unexpected %s without option", s)
+				}
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithResumableVerification())
+			for _, s := range []string{"def verify_start(", "def verify_finish(",
+				"def delete_session(", `key_prefix=b"s"`,
+				"deposit: py.gtxn.PaymentTransaction",
+				"assert deposit.amount == SESSION_DEPOSIT",
+				"SESSION_DEPOSIT = 108_500",
+				"self.refund_deposit(progress)"} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if strings.Contains(code, "def verify(") {
+				t.Errorf("unexpected single call verify method")
+			}
+			if n := strings.Count(code, "Bytes.from_hex("); n != 2*strings.Count(
+				renderVerifier(t, vk, SmartContract), "Bytes.from_hex(") {
+				t.Errorf("verifying key not read by both verify methods")
+			}
+
+			var buf bytes.Buffer
+			err := WritePythonCode(vk, LogicSig, &buf, WithResumableVerification())
+			if err == nil {
+				t.Errorf("expected error for resumable logicsig verifier")
+			}
+			err = WritePythonCode(vk, SmartContract, &buf, WithAVMVersion(10),
+				WithResumableVerification())
+			if err != nil {
+				t.Errorf("unexpected error on AVM version 10: %v", err)
+			}
+		})
+	}
+}
+
+// TestOpUp tests that WithOpUp raises the budget to EstimateOpcodeBudget.
+func TestOpUp(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			vk0 := testVkWithCommitments(t, curve, 0)
+			vk1 := testVkWithCommitments(t, curve, 1)
+			code := renderVerifier(t, vk0, SmartContract)
+			if strings.Contains(code, "ensure_budget") {
+				t.Errorf("unexpected ensure_budget without option")
+			}
+
+			budget, err := EstimateOpcodeBudget(vk0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code = renderVerifier(t, vk0, SmartContract, WithOpUp())
+			ensure := fmt.Sprintf("py.ensure_budget(%d, py.OpUpFeeSource.GroupCredit)",
+				budget)
+			if !strings.Contains(code, ensure) {
+				t.Errorf("missing %s in generated code", ensure)
+			}
+
+			budget1, err := EstimateOpcodeBudget(vk1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if budget1 <= budget {
+				t.Errorf("budget %d with one commitment not above %d", budget1, budget)
+			}
+			checked, err := EstimateOpcodeBudget(vk0, WithSubgroupChecks())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checked <= budget {
+				t.Errorf("budget %d with subgroup checks not above %d", checked, budget)
+			}
+			stateful, err := EstimateOpcodeBudget(vk0, WithNullifier(0),
+				WithVerifiedEvent(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stateful <= budget {
+				t.Errorf("budget %d with nullifier and event not above %d",
+					stateful, budget)
+			}
+			for _, opt := range []Option{WithDomainSeparation(0, 1),
+				WithFailureReasons(), WithBoxInputs()} {
+				optioned, err := EstimateOpcodeBudget(vk0, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if optioned <= budget {
+					t.Errorf("budget %d with option not above %d", optioned, budget)
+				}
+			}
+			fee, err := OpUpFee(vk0, 1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fee < uint64(budget/appCallBudget)*1000 {
+				t.Errorf("fee %d does not cover budget %d", fee, budget)
+			}
+			boxed, err := EstimateOpcodeBudget(vk0, WithBoxInputs())
+			if err != nil {
+				t.Fatal(err)
+			}
+			code = renderVerifier(t, vk0, SmartContract, WithOpUp(), WithBoxInputs())
+			ensure = fmt.Sprintf("py.ensure_budget(%d, py.OpUpFeeSource.GroupCredit)",
+				boxed-budgetBoxInputs)
+			if !strings.Contains(code, ensure) {
+				t.Errorf("missing %s in generated code", ensure)
+			}
+			uploaded, err := OpUpFee(vk0, 1000, WithBoxInputs())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uploaded <= fee {
+				t.Errorf("fee %d with box inputs does not cover the refund and "+
+					"the reading of the box above fee %d", uploaded, fee)
+			}
+
+			var buf bytes.Buffer
+			if err := WritePythonCode(vk0, LogicSig, &buf, WithOpUp()); err == nil {
+				t.Errorf("expected error for op-up logicsig verifier")
+			}
+			err = WritePythonCode(vk0, SmartContract, &buf, WithOpUp(),
+				WithResumableVerification())
+			if err == nil {
+				t.Errorf("expected error combining op-up and resumable verification")
+			}
+			err = WritePythonCode(vk0, SmartContract, &buf, WithOpUp(),
+				WithPostVerifyHook("pass"))
+			if err == nil {
+				t.Errorf("expected error combining op-up and a post-verify hook")
+			}
+		})
+	}
+}
+
+// TestPostVerifyHook tests that hooks are reindented and run after verifying.
+func TestPostVerifyHook(t *testing.T) {
+	hook := `
+    total = BigUInt.from_bytes(public_inputs[0].bytes)
+    if total > 0:
+        for i in urange(2):
+            if i == 1:
+                self.total = total
+`
+	want := "\t\t\"\"\"Act on the verification of a valid proof for public_inputs.\"\"\"\n" +
+		"\t\ttotal = BigUInt.from_bytes(public_inputs[0].bytes)\n" +
+		"\t\tif total > 0:\n" +
+		"\t\t\tfor i in urange(2):\n" +
+		"\t\t\t\tif i == 1:\n" +
+		"\t\t\t\t\tself.total = total\n"
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithCommitments(t, curve, 0)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "on_verified") {
+				t.Errorf("unexpected on_verified without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithPostVerifyHook(hook))
+			if !strings.Contains(code, want) {
+				t.Errorf("missing hook body in generated code")
+			}
+			if !strings.Contains(code, "\t\tif check:\n\t\t\tself.on_verified(public_inputs)\n"+
+				"\t\treturn arc4.Bool(check)\n") {
+				t.Errorf("hook not called after the pairing check")
+			}
+
+			var buf bytes.Buffer
+			err := WritePythonCode(vk, LogicSig, &buf, WithPostVerifyHook(hook))
+			if err == nil {
+				t.Errorf("expected error for logicsig verifier with hook")
+			}
+
+			typedVk := testVkWithPublicInputs(t, curve, 9)
+			code = renderVerifier(t, typedVk, SmartContract,
+				WithTypedPublicInputs(&typedInputsTestCircuit{}),
+				WithPostVerifyHook("self.total = old_root.as_biguint()"))
+			for _, s := range []string{
+				"def on_verified(self, old_root: UInt256, leaves: StaticArray[StaticArray[" +
+					"UInt256, typing.Literal[3]], typing.Literal[2]], account_app_id: UInt256, " +
+					"in_: UInt256) -> None:",
+				"\t\t\tself.on_verified(\n" +
+					"\t\t\t\tUInt256.from_bytes(public_inputs.bytes[2:34]),\n" +
+					"\t\t\t\tStaticArray[StaticArray[UInt256, typing.Literal[3]], " +
+					"typing.Literal[2]].from_bytes(public_inputs.bytes[34:226]),\n" +
+					"\t\t\t\tUInt256.from_bytes(public_inputs.bytes[226:258]),\n" +
+					"\t\t\t\tUInt256.from_bytes(public_inputs.bytes[258:290]),\n" +
+					"\t\t\t)\n",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+		})
+	}
+}
+
+func TestNullifier(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 3)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "nullifier") {
+				t.Errorf("unexpected nullifier code without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithNullifier(2))
+			for _, s := range []string{
+				`self.nullifiers = py.BoxMap(Bytes, Bytes, key_prefix=b"n")`,
+				"def is_spent(self, nullifier: Bytes32) -> arc4.Bool:",
+				"if public_inputs[2].bytes in self.nullifiers:",
+				"self.nullifiers[public_inputs[2].bytes] = py.op.itob(py.Global.round)",
+				"NULLIFIER_DEPOSIT = 18_900",
+				"assert deposit.amount == NULLIFIER_DEPOSIT",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			for _, index := range []int{-1, 3} {
+				err := WritePythonCode(vk, SmartContract, &buf, WithNullifier(index))
+				if err == nil {
+					t.Errorf("expected error for nullifier index %d", index)
+				}
+			}
+			if err := WritePythonCode(vk, LogicSig, &buf, WithNullifier(0)); err == nil {
+				t.Errorf("expected error for logicsig verifier with nullifier")
+			}
+		})
+	}
+}
+
+func TestStateRoot(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 3)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "state_root") {
+				t.Errorf("unexpected state root code without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithStateRoot(2, 0))
+			for _, s := range []string{
+				"def create(self, name: String, state_root: Bytes32) -> None:",
+				"if public_inputs[2] != self.state_root:",
+				"self.state_root = public_inputs[0].copy()",
+				`arc4.emit("StateTransition(byte[32],byte[32])",`,
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			for _, roots := range [][2]int{{0, 0}, {0, 3}, {-1, 1}} {
+				err := WritePythonCode(vk, SmartContract, &buf,
+					WithStateRoot(roots[0], roots[1]))
+				if err == nil {
+					t.Errorf("expected error for state roots %v", roots)
+				}
+			}
+			err := WritePythonCode(vk, LogicSig, &buf, WithStateRoot(0, 1))
+			if err == nil {
+				t.Errorf("expected error for logicsig verifier with state root")
+			}
+		})
+	}
+}
+
+func TestTxnBinding(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 4)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, LogicSig)
+			if strings.Contains(code, "bind the proof") {
+				t.Errorf("unexpected transaction bindings without option")
+			}
+
+			code = renderVerifier(t, vk, LogicSig, WithTxnBinding(TxnReceiver, 1),
+				WithTxnBinding(TxnAmount, 3), WithTxnBinding(TxnValidUntil, 0))
+			for _, s := range []string{
+				"assert bzero(16) + py.Txn.receiver.bytes[:16] + bzero(16) + " +
+					"py.Txn.receiver.bytes[16:] == public_inputs[32:96]",
+				"assert BigUInt(py.Txn.amount) == BigUInt.from_bytes(public_inputs[96:128])",
+				"assert BigUInt(py.Txn.last_valid) <= BigUInt.from_bytes(public_inputs[0:32])",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			err := WritePythonCode(vk, LogicSig, &buf, WithTxnBinding(TxnAmount, 4))
+			if err == nil {
+				t.Errorf("expected error for public input out of range")
+			}
+			err = WritePythonCode(vk, LogicSig, &buf, WithTxnBinding(TxnSender, 3))
+			if err == nil {
+				t.Errorf("expected error for low limb out of range")
+			}
+			err = WritePythonCode(vk, LogicSig, &buf, WithTxnBinding(TxnField(-1), 0))
+			if err == nil {
+				t.Errorf("expected error for unknown transaction field")
+			}
+			err = WritePythonCode(vk, SmartContract, &buf, WithTxnBinding(TxnSender, 0))
+			if err == nil {
+				t.Errorf("expected error for smart contract with transaction binding")
+			}
+		})
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 2)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, LogicSig)
+			if strings.Contains(code, "py.op.arg(") {
+				t.Errorf("unexpected logicsig arguments without option")
+			}
+
+			code = renderVerifier(t, vk, LogicSig, WithEscrow(),
+				WithTxnBinding(TxnGroupID, 0))
+			for _, s := range []string{
+				"proof = py.op.arg(0)",
+				"public_inputs = py.op.arg(1)",
+				"py.Txn.type_enum == py.TransactionType.Payment",
+				"assert py.Txn.fee <= 0\n",
+				"assert py.Txn.close_remainder_to == py.Global.zero_address",
+				"assert py.Txn.rekey_to == py.Global.zero_address",
+				"py.Global.group_id[:16]",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if strings.Contains(code, "application_args") {
+				t.Errorf("unexpected application arguments in escrow verifier")
+			}
+
+			code = renderVerifier(t, vk, LogicSig, WithEscrow(), WithMaxFee(2000),
+				WithCloseTo(), WithRekey())
+			if !strings.Contains(code, "assert py.Txn.fee <= 2000\n") {
+				t.Errorf("missing max fee in generated code")
+			}
+			for _, s := range []string{"close_remainder_to", "asset_close_to",
+				"rekey_to"} {
+				if strings.Contains(code, s) {
+					t.Errorf("unexpected %s constraint when allowed", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			err := WritePythonCode(vk, SmartContract, &buf, WithEscrow())
+			if err == nil {
+				t.Errorf("expected error for smart contract with escrow")
+			}
+			err = WritePythonCode(vk, LogicSig, &buf, WithCloseTo())
+			if err == nil {
+				t.Errorf("expected error for close-to without escrow")
+			}
+			err = WritePythonCode(vk, LogicSig, &buf, WithTxnBinding(TxnGroupID, 0))
+			if err == nil {
+				t.Errorf("expected error for group ID binding without escrow")
+			}
+		})
+	}
+}
+
+func TestLogicSigConstraints(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 2)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, LogicSig)
+			for _, s := range []string{
+				"assert py.Txn.type_enum == py.TransactionType.ApplicationCall",
+				"assert py.Txn.fee <= 0\n",
+				"assert py.Txn.close_remainder_to == py.Global.zero_address",
+				"assert py.Txn.asset_close_to == py.Global.zero_address",
+				"assert py.Txn.rekey_to == py.Global.zero_address",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if strings.Contains(code, "py.Txn.lease") {
+				t.Errorf("unexpected lease constraint without option")
+			}
+
+			code = renderVerifier(t, vk, LogicSig, WithMaxFee(1000), WithLease(),
+				WithTxnBinding(TxnLease, 0))
+			for _, s := range []string{
+				"assert py.Txn.fee <= 1000\n",
+				"assert py.Txn.lease != bzero(32)",
+				"assert bzero(16) + py.Txn.lease[:16] + bzero(16) + " +
+					"py.Txn.lease[16:] == public_inputs[0:64]",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			code = renderVerifier(t, vk, LogicSig, WithEscrow(), WithLease())
+			if !strings.Contains(code, "assert py.Txn.lease != bzero(32)") {
+				t.Errorf("missing lease constraint in escrow verifier")
+			}
+
+			var buf bytes.Buffer
+			for _, opt := range []Option{WithMaxFee(1000), WithLease()} {
+				err := WritePythonCode(vk, SmartContract, &buf, opt)
+				if err == nil {
+					t.Errorf("expected error for smart contract with logicsig " +
+						"constraints")
+				}
+			}
+		})
+	}
+}
+
+func TestDomainSeparation(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 3)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "genesis_hash") {
+				t.Errorf("unexpected domain separation without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithResumableVerification(),
+				WithDomainSeparation(1, 0))
+			for _, s := range []string{
+				"if (public_inputs[1].bytes\n" +
+					"\t\t\t\t!= bzero(16) + py.Global.genesis_hash[:16]",
+				"or public_inputs[2].bytes\n" +
+					"\t\t\t\t!= bzero(16) + py.Global.genesis_hash[16:]",
+				"or BigUInt.from_bytes(public_inputs[0].bytes)\n" +
+					"\t\t\t\t!= BigUInt(py.Global.current_application_id.id)):",
+			} {
+				if strings.Count(code, s) != 2 {
+					t.Errorf("missing %s in verify_start and verify_finish", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			for _, indexes := range [][2]int{{1, 1}, {0, 1}, {2, 0}, {0, 3}, {-1, 2}} {
+				err := WritePythonCode(vk, SmartContract, &buf,
+					WithDomainSeparation(indexes[0], indexes[1]))
+				if err == nil {
+					t.Errorf("expected error for domain public inputs %v", indexes)
+				}
+			}
+			err := WritePythonCode(vk, LogicSig, &buf, WithDomainSeparation(0, 2))
+			if err == nil {
+				t.Errorf("expected error for logicsig verifier with domain separation")
+			}
+		})
+	}
+}
+
+func TestHashedPublicInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 1)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, LogicSig)
+			if strings.Contains(code, "mimc") {
+				t.Errorf("unexpected mimc without option")
+			}
+
+			for _, outputType := range []ContractType{LogicSig, SmartContract} {
+				code = renderVerifier(t, vk, outputType, WithHashedPublicInputs(12),
+					WithAVMVersion(11))
+				for _, s := range []string{"py.op.mimc(", "public_inputs.length == 12"} {
+					if !strings.Contains(code, s) {
+						t.Errorf("%d: missing %s in generated code", outputType, s)
+					}
+				}
+			}
+			code = renderVerifier(t, vk, SmartContract, WithHashedPublicInputs(12),
+				WithNullifier(11))
+			if !strings.Contains(code, "public_inputs[11].bytes in self.nullifiers") {
+				t.Errorf("missing nullifier check on the hashed public inputs")
+			}
+
+			var buf bytes.Buffer
+			err := WritePythonCode(vk, SmartContract, &buf, WithHashedPublicInputs(2),
+				WithAVMVersion(10))
+			if err == nil {
+				t.Errorf("expected error for hashed public inputs on AVM 10")
+			}
+			vk2 := testVkWithPublicInputs(t, curve, 2)
+			err = WritePythonCode(vk2, SmartContract, &buf, WithHashedPublicInputs(2))
+			if err == nil {
+				t.Errorf("expected error for hashed public inputs with two digests")
+			}
+		})
+	}
+}
+
+// TestBoxInputs verifies that WithBoxInputs adds the upload methods, sized
+// for the proof and public inputs, to smart contract verifiers only.
+func TestBoxInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 3)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "verify_uploaded") {
+				t.Errorf("unexpected box inputs without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithBoxInputs())
+			proofLength := 24
+			if curve == ecc.BLS12_381 {
+				proofLength = 33
+			}
+			for _, s := range []string{
+				"def start_upload(self, deposit: py.gtxn.PaymentTransaction)",
+				"assert deposit.amount == UPLOAD_DEPOSIT",
+				"def upload(self, offset: arc4.UInt64, chunk: arc4.DynamicBytes)",
+				"def delete_upload(self) -> None:",
+				"def verify_uploaded(self) -> arc4.Bool:",
+				"return self.verify(proof, public_inputs)",
+				fmt.Sprintf("UPLOAD_PROOF_LENGTH = %d\n", proofLength),
+				"UPLOAD_PUBLIC_INPUTS_LENGTH = 3\n",
+				fmt.Sprintf("UPLOAD_DEPOSIT = %d\n",
+					2_500+400*(33+32*(proofLength+3))),
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if n := strings.Count(code, "self.refund_upload()"); n != 2 {
+				t.Errorf("expected 2 deposit refunds, got %d", n)
+			}
+
+			var buf bytes.Buffer
+			for _, outputType := range []ContractType{LogicSig, Subroutine} {
+				if err := WritePythonCode(vk, outputType, &buf, WithBoxInputs()); err == nil {
+					t.Errorf("%d: expected error for box inputs", outputType)
+				}
+			}
+			err := WritePythonCode(vk, SmartContract, &buf, WithBoxInputs(),
+				WithResumableVerification())
+			if err == nil {
+				t.Errorf("expected error for box inputs with resumable verification")
+			}
+			err = WritePythonCode(vk, SmartContract, &buf, WithBoxInputs(),
+				WithAVMVersion(7))
+			if err == nil {
+				t.Errorf("expected error for box inputs on AVM 7")
+			}
+
+			hashed := testVkWithPublicInputs(t, curve, 1)
+			err = WritePythonCode(hashed, SmartContract, &buf, WithBoxInputs(),
+				WithHashedPublicInputs(128))
+			if err == nil {
+				t.Errorf("expected error for box inputs exceeding a box read")
+			}
+		})
+	}
+}
+
+// TestGroupArgs verifies that WithGroupArgs makes logicsig verifiers and
+// companion modules read the proof and public inputs from the configured app
+// call arguments.
+func TestGroupArgs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 2)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, LogicSig)
+			if strings.Contains(code, "py.gtxn") {
+				t.Errorf("unexpected group arguments without option")
+			}
+
+			for _, opts := range [][]Option{{}, {WithEscrow()}} {
+				opts = append(opts, WithGroupArgs(2, 4, 1))
+				code = renderVerifier(t, vk, LogicSig, opts...)
+				for _, s := range []string{
+					"args_txn = py.gtxn.ApplicationCallTransaction(2)",
+					"proof = args_txn.app_args(4)[2:]",
+					"public_inputs = args_txn.app_args(1)[2:]",
+				} {
+					if !strings.Contains(code, s) {
+						t.Errorf("missing %s in generated code", s)
+					}
+				}
+				for _, s := range []string{"py.Txn.application_args", "py.op.arg"} {
+					if strings.Contains(code, s) {
+						t.Errorf("unexpected %s in generated code", s)
+					}
+				}
+			}
+
+			code = renderVerifier(t, vk, Companion, WithGroupArgs(2, 4, 1),
+				WithLogicSigProgram([]byte{1}))
+			for _, s := range []string{
+				"txn = gtxn.Transaction(group_index)",
+				"args_txn = gtxn.ApplicationCallTransaction(2)",
+				"assert args_txn.num_app_args >= 5",
+				"DynamicArray[Bytes32].from_bytes(args_txn.app_args(1))",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in companion module", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			for _, args := range [][3]int{{16, 1, 2}, {-1, 1, 2}, {0, 16, 2},
+				{0, 1, -1}, {0, 2, 2}} {
+				err := WritePythonCode(vk, LogicSig, &buf,
+					WithGroupArgs(args[0], args[1], args[2]))
+				if err == nil {
+					t.Errorf("expected error for group arguments %v", args)
+				}
+			}
+			for _, outputType := range []ContractType{SmartContract, Subroutine} {
+				err := WritePythonCode(vk, outputType, &buf, WithGroupArgs(0, 1, 2))
+				if err == nil {
+					t.Errorf("%d: expected error for group arguments", outputType)
+				}
+			}
+			err := WritePythonCode(vk, LogicSig, &buf, WithEscrow(),
+				WithGroupArgs(0, 1, 2), WithTxnBinding(TxnGroupID, 0))
+			if err == nil {
+				t.Errorf("expected error for group ID binding with group arguments")
+			}
+			err = WritePythonCode(vk, LogicSig, &buf, WithEscrow(),
+				WithGroupArgs(0, 1, 2), WithRekey())
+			if err == nil {
+				t.Errorf("expected error for rekey with group arguments")
+			}
+		})
+	}
+}
+
+// TestFailureReasons verifies that WithFailureReasons makes smart contract
+// verifiers return and logicsig verifiers assert the reason why they reject a
+// proof.
+func TestFailureReasons(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 2)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "verify_with_reason") {
+				t.Errorf("unexpected failure reasons without option")
+			}
+			code = renderVerifier(t, vk, LogicSig)
+			if strings.Contains(code, "PAIRING_FAILED") {
+				t.Errorf("unexpected failure reasons without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract, WithFailureReasons())
+			for _, s := range []string{
+				"def verify_with_reason(",
+				"return arc4.Bool(self.verify_with_reason(proof, public_inputs).native == VERIFIED)",
+				"return arc4.UInt8(MALFORMED_INPUT)",
+				"return arc4.UInt8(NON_CANONICAL_PROOF)",
+				"return arc4.UInt8(VERIFIED if check else PAIRING_FAILED)",
+				"PAIRING_FAILED = 5\n",
+				"REJECTED_TRANSACTION = 9\n",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if strings.Contains(code, "return arc4.Bool(False)") {
+				t.Errorf("unexpected rejection without reason")
+			}
+
+			code = renderVerifier(t, vk, LogicSig, WithFailureReasons())
+			for _, s := range []string{
+				`assert check, "PAIRING_FAILED"`,
+				`assert False, "NON_CANONICAL_PROOF"`,
+				`assert False, "NON_CANONICAL_PUBLIC_INPUT"`,
+				`, "MALFORMED_INPUT"`,
+				`, "REJECTED_TRANSACTION"`,
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if strings.Contains(code, "return False") {
+				t.Errorf("unexpected rejection without reason")
+			}
+
+			var buf bytes.Buffer
+			err := WritePythonCode(vk, Subroutine, &buf, WithFailureReasons())
+			if err == nil {
+				t.Errorf("expected error for failure reasons in a subroutine")
+			}
+			err = WritePythonCode(vk, Companion, &buf, WithFailureReasons(),
+				WithLogicSigProgram([]byte{1}))
+			if err == nil {
+				t.Errorf("expected error for failure reasons in a companion module")
+			}
+			err = WritePythonCode(vk, SmartContract, &buf, WithFailureReasons(),
+				WithResumableVerification())
+			if err == nil {
+				t.Errorf("expected error for failure reasons with resumable verification")
+			}
+		})
+	}
+
+	for r := Verified; r <= RejectedTransaction; r++ {
+		parsed, err := ParseFailureReason(r.String())
+		if err != nil || parsed != r {
+			t.Errorf("failed to parse %s: %v", r, err)
+		}
+	}
+	if _, err := ParseFailureReason("UNKNOWN"); err == nil {
+		t.Errorf("expected error for unknown failure reason")
+	}
+}
+
+// TestVerifiedEvent verifies that WithVerifiedEvent makes smart contract
+// verifiers emit an event with the verifying key hash for valid proofs.
+func TestVerifiedEvent(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 2)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "arc4.emit") {
+				t.Errorf("unexpected verified event without option")
+			}
+
+			vkHash, err := VerifyingKeyHash(vk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code = renderVerifier(t, vk, SmartContract, WithVerifiedEvent(false))
+			for _, s := range []string{
+				`arc4.emit("` + VerifiedEventSignature + `"`,
+				fmt.Sprintf(`Bytes.from_hex("%x")`, vkHash),
+				"sha256(public_inputs.bytes[2:])))",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			code = renderVerifier(t, vk, SmartContract, WithVerifiedEvent(true))
+			for _, s := range []string{
+				`arc4.emit("` + VerifiedEventWithPublicInputsSignature + `"`,
+				"public_inputs)",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			for _, outputType := range []ContractType{LogicSig, Subroutine} {
+				err := WritePythonCode(vk, outputType, &buf, WithVerifiedEvent(false))
+				if err == nil {
+					t.Errorf("%d: expected error for verified event", outputType)
+				}
+			}
+
+			hashed := testVkWithPublicInputs(t, curve, 1)
+			err = WritePythonCode(hashed, SmartContract, &buf,
+				WithVerifiedEvent(true), WithHashedPublicInputs(29))
+			if err != nil {
+				t.Errorf("unexpected error for 29 public inputs in event: %v", err)
+			}
+			err = WritePythonCode(hashed, SmartContract, &buf,
+				WithVerifiedEvent(true), WithHashedPublicInputs(30))
+			if err == nil {
+				t.Errorf("expected error for 30 public inputs in event")
+			}
+			err = WritePythonCode(hashed, SmartContract, &buf,
+				WithVerifiedEvent(false), WithHashedPublicInputs(30))
+			if err != nil {
+				t.Errorf("unexpected error for hashes of 30 public inputs: %v", err)
+			}
+		})
+	}
+}
+
+// typedInputsTestCircuit declares public fields of every shape supported by
+// WithTypedPublicInputs: a variable, a nested array, a variable in a struct
+// and a variable whose name is a python keyword
+type typedInputsTestCircuit struct {
+	OldRoot frontend.Variable `gnark:",public"`
+	Secret  frontend.Variable
+	Leaves  [2][3]frontend.Variable `gnark:",public"`
+	Account struct {
+		AppID frontend.Variable
+	} `gnark:",public"`
+	In frontend.Variable `gnark:"in,public"`
+}
+
+func (c *typedInputsTestCircuit) Define(api frontend.API) error {
+	return nil
+}
+
+type typedInputsStructArrayCircuit struct {
+	Accounts [2]struct {
+		ID frontend.Variable `gnark:",public"`
+	}
+}
+
+func (c *typedInputsStructArrayCircuit) Define(api frontend.API) error {
+	return nil
+}
+
+type typedInputsDuplicateCircuit struct {
+	A_B frontend.Variable `gnark:",public"`
+	A   struct {
+		B frontend.Variable
+	} `gnark:",public"`
+}
+
+func (c *typedInputsDuplicateCircuit) Define(api frontend.API) error {
+	return nil
+}
+
+// TestTypedPublicInputs verifies that WithTypedPublicInputs makes `verify`
+// take the public fields of the circuit, in the order of the public inputs,
+// and that circuits not matching the verifying key are rejected.
+func TestTypedPublicInputs(t *testing.T) {
+	fields, err := PublicFields(&typedInputsTestCircuit{}, ecc.BN254)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, abiType string
+	}{
+		{"old_root", "uint256"},
+		{"leaves", "uint256[3][2]"},
+		{"account_app_id", "uint256"},
+		{"in_", "uint256"},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("got %d public fields, want %d", len(fields), len(want))
+	}
+	for i, f := range fields {
+		if f.Name != want[i].name || f.ABIType() != want[i].abiType {
+			t.Errorf("field %d: got %s %s, want %s %s", i, f.ABIType(), f.Name,
+				want[i].abiType, want[i].name)
+		}
+	}
+	for _, circuit := range []frontend.Circuit{
+		&typedInputsStructArrayCircuit{}, &typedInputsDuplicateCircuit{},
+	} {
+		if _, err := PublicFields(circuit, ecc.BN254); err == nil {
+			t.Errorf("%T: expected error", circuit)
+		}
+	}
+
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithPublicInputs(t, curve, 9)
+		t.Run(curve.String(), func(t *testing.T) {
+			code := renderVerifier(t, vk, SmartContract)
+			if strings.Contains(code, "def verify_proof") {
+				t.Errorf("unexpected typed verify without option")
+			}
+
+			code = renderVerifier(t, vk, SmartContract,
+				WithTypedPublicInputs(&typedInputsTestCircuit{}), WithBoxInputs())
+			for _, s := range []string{
+				"old_root: UInt256,",
+				"leaves: StaticArray[StaticArray[UInt256, typing.Literal[3]], typing.Literal[2]],",
+				"py.op.itob(9)[6:] + old_root.bytes + leaves.bytes + account_app_id.bytes + in_.bytes",
+				"def verify_proof(self,",
+				"return self.verify_proof(proof, public_inputs)",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			var buf bytes.Buffer
+			typed := WithTypedPublicInputs(&typedInputsTestCircuit{})
+			for _, opts := range [][]Option{
+				{typed, WithResumableVerification()},
+				{typed, WithFailureReasons()},
+				{WithTypedPublicInputs(&publicInputsTestCircuit{
+					P: make([]frontend.Variable, 8)})},
+			} {
+				if err := WritePythonCode(vk, SmartContract, &buf, opts...); err == nil {
+					t.Errorf("expected error for typed public inputs")
+				}
+			}
+			if err := WritePythonCode(vk, LogicSig, &buf, typed); err == nil {
+				t.Errorf("expected error for typed public inputs in a logicsig")
+			}
+		})
+	}
+}
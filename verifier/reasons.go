@@ -0,0 +1,117 @@
+package verifier
+
+import "fmt"
+
+// FailureReason is the reason a verifier rejects a proof, as returned by the
+// `verify_with_reason` method of smart contract verifiers generated with
+// WithFailureReasons and recovered from the failures of logicsig verifiers
+// generated with the same option with utils.LogicSigFailureReason
+type FailureReason uint8
+
+const (
+	// Verified means the proof is valid
+	Verified FailureReason = iota
+	// MalformedInput means the proof or the public inputs do not have the
+	// expected length
+	MalformedInput
+	// NonCanonicalProof means a proof evaluation is not reduced modulo the
+	// curve order
+	NonCanonicalProof
+	// NonCanonicalPublicInput means a public input is not reduced modulo the
+	// curve order
+	NonCanonicalPublicInput
+	// InvalidPoint means a proof point is not in the prime-order subgroup,
+	// checked with WithSubgroupChecks
+	InvalidPoint
+	// PairingFailed means the final pairing check failed
+	PairingFailed
+	// WrongDomain means the proof is bound to another network or app, checked
+	// with WithDomainSeparation
+	WrongDomain
+	// SpentNullifier means the nullifier of the proof was already used,
+	// checked with WithNullifier
+	SpentNullifier
+	// StaleStateRoot means the proof does not start from the current state
+	// root, checked with WithStateRoot
+	StaleStateRoot
+	// RejectedTransaction means a logicsig verifier does not sign the
+	// transaction, because of its type, fee, close-to, rekey or lease fields or
+	// of a transaction binding
+	RejectedTransaction
+)
+
+// failureReasonNames are the names of the failure reasons in the generated
+// verifiers
+var failureReasonNames = [...]string{
+	Verified:                "VERIFIED",
+	MalformedInput:          "MALFORMED_INPUT",
+	NonCanonicalProof:       "NON_CANONICAL_PROOF",
+	NonCanonicalPublicInput: "NON_CANONICAL_PUBLIC_INPUT",
+	InvalidPoint:            "INVALID_POINT",
+	PairingFailed:           "PAIRING_FAILED",
+	WrongDomain:             "WRONG_DOMAIN",
+	SpentNullifier:          "SPENT_NULLIFIER",
+	StaleStateRoot:          "STALE_STATE_ROOT",
+	RejectedTransaction:     "REJECTED_TRANSACTION",
+}
+
+// String returns the name of the failure reason in the generated verifiers
+func (r FailureReason) String() string {
+	if int(r) < len(failureReasonNames) {
+		return failureReasonNames[r]
+	}
+	return fmt.Sprintf("FailureReason(%d)", uint8(r))
+}
+
+// ParseFailureReason returns the failure reason named `name` in the generated
+// verifiers, e.g., in the error messages of logicsig verifiers
+func ParseFailureReason(name string) (FailureReason, error) {
+	for r, n := range failureReasonNames {
+		if n == name {
+			return FailureReason(r), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown failure reason %q", name)
+}
+
+// templateFailureReasons returns the failure reasons the smart contract
+// verifiers declare as constants
+func templateFailureReasons() []FailureReason {
+	reasons := make([]FailureReason, len(failureReasonNames))
+	for i := range reasons {
+		reasons[i] = FailureReason(i)
+	}
+	return reasons
+}
+
+// templateReject returns the statement with which a verifier of type
+// `outputType` generated with `o` rejects a proof for reason `name`
+func templateReject(o *options, outputType ContractType, name string,
+) (string, error) {
+	if _, err := ParseFailureReason(name); err != nil {
+		return "", err
+	}
+	switch {
+	case outputType == SmartContract && o.FailureReasons:
+		return fmt.Sprintf("return arc4.UInt8(%s)", name), nil
+	case outputType == SmartContract:
+		return "return arc4.Bool(False)", nil
+	case o.FailureReasons:
+		return fmt.Sprintf("assert False, %q", name), nil
+	default:
+		return "return False", nil
+	}
+}
+
+// templateBecause returns the message of the asserts with which a logicsig
+// verifier generated with `o` rejects a proof or a transaction for reason
+// `name`, empty without WithFailureReasons
+func templateBecause(o *options, name string) (string, error) {
+	if _, err := ParseFailureReason(name); err != nil {
+		return "", err
+	}
+	if !o.FailureReasons {
+		return "", nil
+	}
+	return fmt.Sprintf(", %q", name), nil
+}
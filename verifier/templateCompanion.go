@@ -0,0 +1,39 @@
+package verifier
+
+const tmplCompanion = `# Code automatically generated - DO NOT EDIT.
+
+import typing
+
+from algopy import subroutine, Account, UInt64, gtxn
+from algopy.arc4 import DynamicArray, StaticArray, Byte
+
+Bytes32: typing.TypeAlias = StaticArray[Byte, typing.Literal[32]]
+
+@subroutine
+def verified_public_inputs(group_index: UInt64) -> DynamicArray[Bytes32]:
+	"""Return the public inputs of the proof verified by the logicsig verifier
+	   signing the {{ if .GroupArgs }}transaction{{ else }}app call{{ end }} at position group_index of the group.
+	   Fail if the {{ if .GroupArgs }}transaction{{ else }}app call{{ end }} is not signed by the logicsig verifier"""
+
+	txn = gtxn.{{ if .GroupArgs }}Transaction{{ else }}ApplicationCallTransaction{{ end }}(group_index)
+
+	# the logicsig verifier only signs {{ if .GroupArgs }}transactions of groups{{ else }}app calls{{ end }} carrying a valid proof and
+	# rejects rekeying, so only it can sign for its address, computed from
+	# its program
+	assert txn.sender == Account("{{ .Address }}")
+{{- if .GroupArgs }}
+
+	# the logicsig verifier reads the proof and public inputs from the app
+	# call at position {{ .GroupIndex }} of the group
+	args_txn = gtxn.ApplicationCallTransaction({{ .GroupIndex }})
+{{- end }}
+
+	# check the proof and public inputs arguments, as read by the verifier
+	assert {{ .ArgsTxn }}.num_app_args >= {{ .NbAppArgs }}
+	assert {{ .ArgsTxn }}.app_args({{ .ProofArg }}).length == 2 + {{ .ProofLength }} * 32
+	assert {{ .ArgsTxn }}.app_args({{ .PublicInputsArg }}).length == 2 + {{ .NbPublicInputs }} * 32
+	public_inputs = DynamicArray[Bytes32].from_bytes({{ .ArgsTxn }}.app_args({{ .PublicInputsArg }}))
+	assert public_inputs.length == {{ .NbPublicInputs }}
+
+	return public_inputs
+`
@@ -5,39 +5,101 @@ const tmplLogicSigVerifierBls12_381 = `# Code automatically generated - DO NOT E
 import typing
 
 import algopy as py
-from algopy import logicsig, subroutine, BigUInt, Bytes, arc4, UInt64, urange
-from algopy.arc4 import UInt256, DynamicArray
-from algopy.op import bzero, sha256, EllipticCurve as ec, EC, setbit_bytes
+from algopy import {{ if not (embedded) }}logicsig, {{ end }}subroutine, BigUInt, Bytes, arc4, UInt64, urange
+from algopy.arc4 import UInt256, DynamicArray{{ if (embedded) }}, StaticArray, Byte{{ end }}
+from algopy.op import bzero, sha256, {{ if (opts).NativeModExp }}bmodexp{{ else }}getbyte{{ end }}, EllipticCurve as ec, EC, setbit_bytes
 
 #################### Curve parameters #################
 
 # curve order
-R_MOD = 52435875175126190479447740508185965837690552500527637822603658699938581184513
+{{ ns }}R_MOD = 52435875175126190479447740508185965837690552500527637822603658699938581184513
 
 # field order
-P_MOD = 4002409555221667393417789825735904156556882819939007885332058136124031650490837864442687629129015664037894272559787
+{{ ns }}P_MOD = 4002409555221667393417789825735904156556882819939007885332058136124031650490837864442687629129015664037894272559787
 
 #################### Trusted setup ####################
 {{ range $index, $element := .Kzg.G2 }}
-G2_SRS_{{ $index }}_X_0 = {{ (fpstr $element.X.A1) }}
-G2_SRS_{{ $index }}_X_1 = {{ (fpstr $element.X.A0) }}
-G2_SRS_{{ $index }}_Y_0 = {{ (fpstr $element.Y.A1) }}
-G2_SRS_{{ $index }}_Y_1 = {{ (fpstr $element.Y.A0) }}
+{{ ns }}G2_SRS_{{ $index }}_X_0 = {{ (fpstr $element.X.A1) }}
+{{ ns }}G2_SRS_{{ $index }}_X_1 = {{ (fpstr $element.X.A0) }}
+{{ ns }}G2_SRS_{{ $index }}_Y_0 = {{ (fpstr $element.Y.A1) }}
+{{ ns }}G2_SRS_{{ $index }}_Y_1 = {{ (fpstr $element.Y.A0) }}
 {{ end }}
-G1_SRS_X = {{ fpstr .Kzg.G1.X }}
-G1_SRS_Y = {{ fpstr .Kzg.G1.Y }}
+{{ ns }}G1_SRS_X = {{ fpstr .Kzg.G1.X }}
+{{ ns }}G1_SRS_Y = {{ fpstr .Kzg.G1.Y }}
 
 ########################################################
 
-@logicsig(name="{{ (contractName) }}")
+{{ if (embedded) -}}
+{{ ns }}Bytes32: typing.TypeAlias = StaticArray[Byte, typing.Literal[32]]
+
+@subroutine
+def verify_proof(proof: DynamicArray[{{ ns }}Bytes32], public_inputs: DynamicArray[{{ ns }}Bytes32]) -> bool:
+	"""Verify the proof for the given public inputs, as passed to an arc4 method.
+	   Return a boolean indicating whether the proof is valid.
+	   Fail if the proof or the public inputs do not have the expected length"""
+	return {{ ns }}verify(proof.bytes[2:], public_inputs.bytes[2:])
+
+@subroutine
+def {{ ns }}verify(proof: Bytes, public_inputs: Bytes) -> bool:
+	"""Verify the proof for the given public inputs, without the arc4 length
+	   prefixes. Return a boolean indicating whether the proof is valid"""
+
+	q = BigUInt({{ ns }}R_MOD)
+{{ else if (opts).Escrow -}}
+@logicsig(name="{{ (contractName) }}"{{ if (opts).AVMVersion }}, avm_version={{ (opts).AVMVersion }}{{ end }})
+def verify() -> bool:
+	"""Verify the proof for the given public inputs and sign a payment or an
+	   asset transfer from the verifier account.
+	   Fail if the proof is invalid"""
+
+	q = BigUInt({{ ns }}R_MOD)
+
+	# only sign payments and asset transfers within the fee, close-to and
+	# rekey constraints
+	assert (py.Txn.type_enum == py.TransactionType.Payment
+			or py.Txn.type_enum == py.TransactionType.AssetTransfer){{ because "REJECTED_TRANSACTION" }}
+	assert py.Txn.fee <= {{ (opts).MaxFee }}{{ because "REJECTED_TRANSACTION" }}
+{{- if not (opts).AllowCloseTo }}
+	assert py.Txn.close_remainder_to == py.Global.zero_address{{ because "REJECTED_TRANSACTION" }}
+	assert py.Txn.asset_close_to == py.Global.zero_address{{ because "REJECTED_TRANSACTION" }}
+{{- end }}
+{{- if not (opts).AllowRekey }}
+	assert py.Txn.rekey_to == py.Global.zero_address{{ because "REJECTED_TRANSACTION" }}
+{{- end }}
+{{- if (opts).Lease }}
+	assert py.Txn.lease != bzero(32){{ because "REJECTED_TRANSACTION" }}
+{{- end }}
+
+{{- if (opts).GroupArgs }}
+{{ template "groupArgs" }}
+{{- else }}
+
+	# read proof and public inputs from the logicsig arguments, as plain
+	# concatenations of 32 bytes values
+	proof = py.op.arg(0)
+	public_inputs = py.op.arg(1)
+{{- end }}
+{{ else -}}
+@logicsig(name="{{ (contractName) }}"{{ if (opts).AVMVersion }}, avm_version={{ (opts).AVMVersion }}{{ end }})
 def verify() -> bool:
 	"""Verify the proof for the given public inputs.
 	   Fail if the proof is invalid"""
 
-	q = BigUInt(R_MOD)
+	q = BigUInt({{ ns }}R_MOD)
 
-	# prevent the verifier account from being rekeyed by this transaction
-	assert py.Txn.rekey_to == py.Global.zero_address
+	# only sign app calls that cannot drain, close or rekey the verifier account
+	assert py.Txn.type_enum == py.TransactionType.ApplicationCall{{ because "REJECTED_TRANSACTION" }}
+	assert py.Txn.fee <= {{ (opts).MaxFee }}{{ because "REJECTED_TRANSACTION" }}
+	assert py.Txn.close_remainder_to == py.Global.zero_address{{ because "REJECTED_TRANSACTION" }}
+	assert py.Txn.asset_close_to == py.Global.zero_address{{ because "REJECTED_TRANSACTION" }}
+	assert py.Txn.rekey_to == py.Global.zero_address{{ because "REJECTED_TRANSACTION" }}
+{{- if (opts).Lease }}
+	assert py.Txn.lease != bzero(32){{ because "REJECTED_TRANSACTION" }}
+{{- end }}
+
+{{- if (opts).GroupArgs }}
+{{ template "groupArgs" }}
+{{- else }}
 
 	# read proof and public inputs
 	# they are passed in to an arc4 contract as DyanmicArray[Bytes32]
@@ -45,10 +107,24 @@ def verify() -> bool:
 	# the length of the array (we also skip the first app arg which is the method name)
 	proof = py.Txn.application_args(1)[2:]
 	public_inputs = py.Txn.application_args(2)[2:]
-
+{{- end }}
+{{ end }}
 	# check proof and public inputs lengths
-	assert proof.length == {{ add 33 (mul 4 (len .CommitmentConstraintIndexes)) }} * 32
-	assert public_inputs.length == {{ .NbPublicVariables }} * 32
+	assert proof.length == {{ add 33 (mul 4 (len .CommitmentConstraintIndexes)) }} * 32{{ because "MALFORMED_INPUT" }}
+	assert public_inputs.length == {{ (nbInputs) }} * 32{{ because "MALFORMED_INPUT" }}
+{{- if (opts).TxnBindings }}
+
+	# bind the proof to the transaction
+{{- range (opts).TxnBindings }}
+	{{ txnBinding . }}{{ because "REJECTED_TRANSACTION" }}
+{{- end }}
+{{- end }}
+{{- if (opts).HashedPublicInputs }}
+
+	# the circuit exposes the MiMC digest of the public inputs as its only
+	# public input
+	digest = py.op.mimc(py.op.MiMCConfigurations.BLS12_381Mp111, public_inputs)
+{{- end }}
 
 	### Read verifying key ###
 	VK_NB_PUBLIC_INPUTS = UInt64({{ .NbPublicVariables }})
@@ -131,34 +207,95 @@ def verify() -> bool:
 			or BigUInt.from_bytes(QCP_{{ $index }}_AT_Z) >= q
 			{{- end }}
 	):
-		return False
+		{{ reject "NON_CANONICAL_PROOF" }}
+
+	{{ if unrolled .NbPublicVariables -}}
+	{{ range $i := .NbPublicVariables -}}
+	public_input_{{ $i }} = BigUInt.from_bytes({{ (inputs) }}[{{ mul $i 32 }}:{{ mul (inc $i) 32 }}])
+	if public_input_{{ $i }} >= q:
+		{{ reject "NON_CANONICAL_PUBLIC_INPUT" }}
 
+	{{ end -}}
+	{{ else -}}
 	for i in urange(VK_NB_PUBLIC_INPUTS):
-		if BigUInt.from_bytes(public_inputs[i*32:(i+1)*32]) >= q:
-			return False
+		if BigUInt.from_bytes({{ (inputs) }}[i*32:(i+1)*32]) >= q:
+			{{ reject "NON_CANONICAL_PUBLIC_INPUT" }}
 
+	{{ end -}}
+	{{ if (opts).SubgroupChecks -}}
+	### check proof points are on the curve and in the prime-order subgroup ###
+	if not (ec.subgroup_check(EC.BLS12_381g1, L_COM)
+			and ec.subgroup_check(EC.BLS12_381g1, R_COM)
+			and ec.subgroup_check(EC.BLS12_381g1, O_COM)
+			and ec.subgroup_check(EC.BLS12_381g1, H_0)
+			and ec.subgroup_check(EC.BLS12_381g1, H_1)
+			and ec.subgroup_check(EC.BLS12_381g1, H_2)
+			and ec.subgroup_check(EC.BLS12_381g1, GRAND_PRODUCT)
+			and ec.subgroup_check(EC.BLS12_381g1, BATCH_OPENING_AT_Z)
+			and ec.subgroup_check(EC.BLS12_381g1, OPENING_AT_Z_OMEGA)
+			{{- range $index, $element := .CommitmentConstraintIndexes }}
+			and ec.subgroup_check(EC.BLS12_381g1, BSB_COM_{{ $index }})
+			{{- end }}
+	):
+		{{ reject "INVALID_POINT" }}
 
+	{{ end -}}
 	# Compute the fiat-shamir challenges as the prover (gnark).
 	# After deriving all challenges, we need to make them modulo R_MOD
 
 	gamma_pre = sha256(b'gamma' + VK_S1_fs + VK_S2_fs + VK_S3_fs + VK_QL_fs
-					+ VK_QR_fs + VK_QM_fs + VK_QO_fs + VK_QK_fs{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}_fs{{ end }} + public_inputs
-					+ fs(L_COM) + fs(R_COM) + fs(O_COM))
+					+ VK_QR_fs + VK_QM_fs + VK_QO_fs + VK_QK_fs{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}_fs{{ end }} + {{ (inputs) }}
+					+ {{ ns }}fs(L_COM) + {{ ns }}fs(R_COM) + {{ ns }}fs(O_COM))
 	beta_pre = sha256(b'beta' + gamma_pre)
-	alpha_pre = sha256(b'alpha' + beta_pre{{ range $index, $element := .CommitmentConstraintIndexes }} + fs(BSB_COM_{{ $index }}){{ end }} + fs(GRAND_PRODUCT))
-	zeta_pre = sha256(b'zeta' + alpha_pre + fs(H_0) + fs(H_1) + fs(H_2))
+	alpha_pre = sha256(b'alpha' + beta_pre{{ range $index, $element := .CommitmentConstraintIndexes }} + {{ ns }}fs(BSB_COM_{{ $index }}){{ end }} + {{ ns }}fs(GRAND_PRODUCT))
+	zeta_pre = sha256(b'zeta' + alpha_pre + {{ ns }}fs(H_0) + {{ ns }}fs(H_1) + {{ ns }}fs(H_2))
 
-	gamma = curvemod(gamma_pre)
-	beta = curvemod(beta_pre)
-	alpha = curvemod(alpha_pre)
-	zeta = curvemod(zeta_pre)
+	gamma = {{ ns }}curvemod(gamma_pre)
+	beta = {{ ns }}curvemod(beta_pre)
+	alpha = {{ ns }}curvemod(alpha_pre)
+	zeta = {{ ns }}curvemod(zeta_pre)
 
 	# Zz is eval of Xⁿ-1 at zeta
-	Zz = (expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
+	Zz = ({{ ns }}expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
 
 	# zn is Zz * 1/n
 	zn = (Zz * VK_INV_DOMAIN_SIZE) % q
 
+	{{ if unrolled .NbPublicVariables -}}
+	# Interpolate the public inputs (PI) with unrolled code: the Lagrange
+	# polynomial of public input i at zeta is omega^i * zn / (zeta - omega^i),
+	# with the powers of omega computed at code generation
+	{{ if gt .NbPublicVariables 0 -}}
+	# The d_i = zeta - omega^i are inverted together, and 1 / d_0 = 1 / (zeta - 1)
+	# is reused for alpha2Lagrange
+	{{ range $i := .NbPublicVariables -}}
+	d_{{ $i }} = (zeta + q - BigUInt({{ frpow $.Generator $i }})) % q
+	{{ end -}}
+	p_0 = d_0
+	{{ range $i := (sub .NbPublicVariables 1) -}}
+	p_{{ inc $i }} = (p_{{ $i }} * d_{{ inc $i }}) % q
+	{{ end -}}
+	inv = {{ ns }}expmod(p_{{ sub .NbPublicVariables 1 }}, q - BigUInt(2), q)
+	{{ range $j := (sub .NbPublicVariables 1) -}}
+	{{ $i := sub (sub $.NbPublicVariables 1) $j -}}
+	inv_{{ $i }} = (inv * p_{{ sub $i 1 }}) % q
+	inv = (inv * d_{{ $i }}) % q
+	{{ end -}}
+	inv_0 = inv
+
+	{{ range $i := .NbPublicVariables -}}
+	{{ if eq $i 0 -}}
+	PI = (public_input_0 * inv_0) % q
+	{{ else -}}
+	tmp = (public_input_{{ $i }} * BigUInt({{ frpow $.Generator $i }})) % q
+	PI = (PI + ((tmp * inv_{{ $i }}) % q)) % q
+	{{ end -}}
+	{{ end -}}
+	PI = (PI * zn) % q
+	{{ else -}}
+	PI = BigUInt(0)
+	{{ end -}}
+	{{ else -}}
 	# Let's prepare to interpolate the public inputs
 	w_ = BigUInt(1)
 	batch = DynamicArray[UInt256]()
@@ -176,7 +313,7 @@ def verify() -> bool:
 		y = (x * prev) % q
 		temp.append(UInt256(y))
 		prev = y
-	inv = expmod(prev, q - BigUInt(2), q)
+	inv = {{ ns }}expmod(prev, q - BigUInt(2), q)
 	i = VK_NB_PUBLIC_INPUTS
 	while i > 0:
 		tmp = BigUInt.from_bytes(batch[i-1].bytes)
@@ -196,19 +333,24 @@ def verify() -> bool:
 	PI = BigUInt(0)
 	for i in urange(VK_NB_PUBLIC_INPUTS):
 		tmp = (BigUInt.from_bytes(batch[i].bytes)
-				* BigUInt.from_bytes(public_inputs[i*32:(i+1)*32])) % q
+				* BigUInt.from_bytes({{ (inputs) }}[i*32:(i+1)*32])) % q
 		PI = (PI + tmp) % q
+	{{ end -}}
 	{{ range $index, $element := .CommitmentConstraintIndexes }}
 	# add the contribution of BSB22 commitment {{ $index }} to the public inputs:
 	# hash_fr(BSB_COM_{{ $index }}) * L_{{ add $.NbPublicVariables $element }}(zeta)
-	w_pow = expmod(VK_OMEGA, BigUInt({{ add $.NbPublicVariables $element }}), q)
-	tmp = expmod((zeta + q - w_pow) % q, q - BigUInt(2), q)
+	w_pow = BigUInt({{ frpow $.Generator (add $.NbPublicVariables $element) }})
+	tmp = {{ ns }}expmod((zeta + q - w_pow) % q, q - BigUInt(2), q)
 	tmp = (tmp * ((w_pow * zn) % q)) % q
-	PI = (PI + ((hash_fr(fs(BSB_COM_{{ $index }})) * tmp) % q)) % q
+	PI = (PI + (({{ ns }}hash_fr({{ ns }}fs(BSB_COM_{{ $index }})) * tmp) % q)) % q
 	{{ end }}
 	# compute alpha2Lagrange: alpha**2 * (z**n - 1) / (z - 1)
+	{{ if and (unrolled .NbPublicVariables) (gt .NbPublicVariables 0) -}}
+	res = inv_0
+	{{ else -}}
 	res = (zeta + q - BigUInt(1)) % q
-	res = expmod(res, q - BigUInt(2), q)
+	res = {{ ns }}expmod(res, q - BigUInt(2), q)
+	{{ end -}}
 	res = (res * zn) % q
 	res = (res * alpha) % q
 	res = (res * alpha) % q
@@ -231,16 +373,14 @@ def verify() -> bool:
 	s1 = (s1 + PI + q - alpha2Lagrange)  % q
 	linearized_poly_at_z = (q - s1)
 
-	# compute the folded commitment to H
+	# compute the scalars to fold the commitment to H into the commitment to the
+	# linearization polynomial: -(zeta^n - 1) * (H_0 + zeta^(n+2) H_1 + zeta^2(n+2) H_2)
 	n2 = VK_DOMAIN_SIZE + BigUInt(2)
-	zn2 = expmod(zeta, n2, q)
-	folded_h = ec.scalar_mul(EC.BLS12_381g1, H_2, zn2.bytes)
-	folded_h = ec.add(EC.BLS12_381g1, folded_h, H_1)
-	folded_h = ec.scalar_mul(EC.BLS12_381g1, folded_h, zn2.bytes)
-	folded_h = ec.add(EC.BLS12_381g1, folded_h, H_0)
-	znminus1 = (expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
-	folded_h = ec.scalar_mul(EC.BLS12_381g1, folded_h, znminus1.bytes)
-	folded_h = invert(folded_h)
+	zn2 = {{ ns }}expmod(zeta, n2, q)
+	znminus1 = ({{ ns }}expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
+	h0 = (q - znminus1) % q
+	h1 = (h0 * zn2) % q
+	h2 = (h1 * zn2) % q
 
 	# compute commitment to linearization polynomial
 	u = (BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA) * beta) % q
@@ -267,139 +407,142 @@ def verify() -> bool:
 	s2 = q - ((s2 * w) % q)
 	s2 = (s2 * alpha + alpha2Lagrange) % q
 
-	lin_poly_com = ec.scalar_mul(EC.BLS12_381g1, VK_QL, L_AT_Z)
-
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QR, R_AT_Z)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QO, O_AT_Z)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-
 	ab = (BigUInt.from_bytes(L_AT_Z) * BigUInt.from_bytes(R_AT_Z)) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QM, ab.bytes)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, VK_QK)
-	{{ range $index, $element := .CommitmentConstraintIndexes }}
-	add_term = ec.scalar_mul(EC.BLS12_381g1, BSB_COM_{{ $index }}, QCP_{{ $index }}_AT_Z)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-	{{ end }}
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_S3, s1.bytes)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-
-	add_term = ec.scalar_mul(EC.BLS12_381g1, GRAND_PRODUCT, s2.bytes)
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
 
-	lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, folded_h)
+	# the commitment to the linearization polynomial, including the folded
+	# commitment to H, is computed with a single multi scalar multiplication
+	lin_poly_com = ec.scalar_mul_multi(EC.BLS12_381g1,
+		VK_QL + VK_QR + VK_QO + VK_QM + VK_QK{{ range $index, $element := .CommitmentConstraintIndexes }} + BSB_COM_{{ $index }}{{ end }}
+		+ VK_S3 + GRAND_PRODUCT + H_0 + H_1 + H_2,
+		L_AT_Z + R_AT_Z + O_AT_Z + UInt256(ab).bytes + UInt256(1).bytes{{ range $index, $element := .CommitmentConstraintIndexes }} + QCP_{{ $index }}_AT_Z{{ end }}
+		+ UInt256(s1).bytes + UInt256(s2).bytes
+		+ UInt256(h0).bytes + UInt256(h1).bytes + UInt256(h2).bytes)
 
 	# generate challenge to fold the opening proofs
 	linearized_poly_at_z_bytes = bzero(32) | linearized_poly_at_z.bytes
 	r_pre = sha256(b'gamma' + UInt256(zeta).bytes + lin_poly_com
-		 + fs(L_COM) + fs(R_COM) + fs(O_COM) + VK_S1_fs + VK_S2_fs{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}_fs{{ end }}
+		 + {{ ns }}fs(L_COM) + {{ ns }}fs(R_COM) + {{ ns }}fs(O_COM) + VK_S1_fs + VK_S2_fs{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}_fs{{ end }}
 		 + linearized_poly_at_z_bytes + L_AT_Z + R_AT_Z
 		 + O_AT_Z + S1_AT_Z + S2_AT_Z{{ range $index, $element := .CommitmentConstraintIndexes }} + QCP_{{ $index }}_AT_Z{{ end }}
 		 + GRAND_PRODUCT_AT_Z_OMEGA)
-	r = curvemod(r_pre)
+	r = {{ ns }}curvemod(r_pre)
 	r_acc = r
 
 	# fold the proof in one point
-	digest = lin_poly_com
-	claims =  linearized_poly_at_z
-
-	add_term = ec.scalar_mul(EC.BLS12_381g1, L_COM, r_acc.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
+	claims = linearized_poly_at_z
 	claims = (claims + (BigUInt.from_bytes(L_AT_Z) * r_acc)) % q
+	fold_scalars = UInt256(r_acc).bytes
 
 	r_acc = (r_acc * r) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, R_COM, r_acc.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
 	claims = (claims + (BigUInt.from_bytes(R_AT_Z) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
 
 	r_acc = (r_acc * r) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, O_COM, r_acc.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
 	claims = (claims + (BigUInt.from_bytes(O_AT_Z) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
 
 	r_acc = (r_acc * r) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_S1, r_acc.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
 	claims = (claims + (BigUInt.from_bytes(S1_AT_Z) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
 
 	r_acc = (r_acc * r) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_S2, r_acc.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
 	claims = (claims + (BigUInt.from_bytes(S2_AT_Z) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
 	{{ range $index, $element := .CommitmentConstraintIndexes }}
 	r_acc = (r_acc * r) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QCP_{{ $index }}, r_acc.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
 	claims = (claims + (BigUInt.from_bytes(QCP_{{ $index }}_AT_Z) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
 	{{ end }}
+	digest = ec.scalar_mul_multi(EC.BLS12_381g1,
+		lin_poly_com + L_COM + R_COM + O_COM + VK_S1 + VK_S2{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}{{ end }},
+		UInt256(1).bytes + fold_scalars)
+
 	# verify the folded proof
-	r_pre = sha256(digest + BATCH_OPENING_AT_Z + fs(GRAND_PRODUCT)
+	r_pre = sha256(digest + BATCH_OPENING_AT_Z + {{ ns }}fs(GRAND_PRODUCT)
 			+ OPENING_AT_Z_OMEGA + UInt256(zeta).bytes + UInt256(r).bytes)
-	r = curvemod(r_pre)
+	r = {{ ns }}curvemod(r_pre)
 
-	quotient = BATCH_OPENING_AT_Z
-	add_term = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
-	quotient = ec.add(EC.BLS12_381g1, quotient, add_term)
-
-	add_term = ec.scalar_mul(EC.BLS12_381g1, GRAND_PRODUCT, r.bytes)
-	digest = ec.add(EC.BLS12_381g1, digest, add_term)
+	quotient = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
+	quotient = ec.add(EC.BLS12_381g1, BATCH_OPENING_AT_Z, quotient)
+	quotient = {{ ns }}invert(quotient)
 
 	claims = (claims + (BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA)
 			  * r)) % q
-	G1_SRS = (bzero(48) | BigUInt(G1_SRS_X).bytes) + (bzero(48) | BigUInt(G1_SRS_Y).bytes)
-	claims_com = ec.scalar_mul(EC.BLS12_381g1, G1_SRS, claims.bytes)
-
-	digest = ec.add(EC.BLS12_381g1, digest, invert(claims_com))
-
-	points_quotient = ec.scalar_mul(EC.BLS12_381g1, BATCH_OPENING_AT_Z, zeta.bytes)
+	G1_SRS = (bzero(48) | BigUInt({{ ns }}G1_SRS_X).bytes) + (bzero(48) | BigUInt({{ ns }}G1_SRS_Y).bytes)
 
+	# add the commitment to z, subtract the commitment to the claimed values and
+	# add the points quotient, with a single multi scalar multiplication
 	zeta_omega = (zeta * VK_OMEGA) % q
-	r = (r * zeta_omega) % q
-	add_term = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
-	points_quotient = ec.add(EC.BLS12_381g1, points_quotient, add_term)
-
-	digest = ec.add(EC.BLS12_381g1, digest, points_quotient)
-	quotient = invert(quotient)
+	digest = ec.scalar_mul_multi(EC.BLS12_381g1,
+		digest + GRAND_PRODUCT + G1_SRS + BATCH_OPENING_AT_Z + OPENING_AT_Z_OMEGA,
+		UInt256(1).bytes + UInt256(r).bytes + UInt256((q - claims) % q).bytes
+		+ UInt256(zeta).bytes + UInt256((r * zeta_omega) % q).bytes)
 
-	g2 = ((bzero(48) | BigUInt(G2_SRS_0_X_1).bytes) + (bzero(48) | BigUInt(G2_SRS_0_X_0).bytes)
-	+ (bzero(48) | BigUInt(G2_SRS_0_Y_1).bytes) + (bzero(48) | BigUInt(G2_SRS_0_Y_0).bytes)
-	+ (bzero(48) | BigUInt(G2_SRS_1_X_1).bytes) + (bzero(48) | BigUInt(G2_SRS_1_X_0).bytes)
-	+ (bzero(48) | BigUInt(G2_SRS_1_Y_1).bytes) + (bzero(48) | BigUInt(G2_SRS_1_Y_0).bytes))
+	g2 = ((bzero(48) | BigUInt({{ ns }}G2_SRS_0_X_1).bytes) + (bzero(48) | BigUInt({{ ns }}G2_SRS_0_X_0).bytes)
+	+ (bzero(48) | BigUInt({{ ns }}G2_SRS_0_Y_1).bytes) + (bzero(48) | BigUInt({{ ns }}G2_SRS_0_Y_0).bytes)
+	+ (bzero(48) | BigUInt({{ ns }}G2_SRS_1_X_1).bytes) + (bzero(48) | BigUInt({{ ns }}G2_SRS_1_X_0).bytes)
+	+ (bzero(48) | BigUInt({{ ns }}G2_SRS_1_Y_1).bytes) + (bzero(48) | BigUInt({{ ns }}G2_SRS_1_Y_0).bytes))
 
 	check = ec.pairing_check(EC.BLS12_381g1, digest + quotient, g2)
+{{- if (opts).FailureReasons }}
+	assert check, "PAIRING_FAILED"
+	return True
+{{- else }}
 	return check
+{{- end }}
 
 
 @subroutine
-def expmod(base: BigUInt, exponent: BigUInt, modulus: BigUInt) -> BigUInt:
-	"""Compute base^exponent % modulus."""
+def {{ ns }}expmod(base: BigUInt, exponent: BigUInt, modulus: BigUInt) -> BigUInt:
+{{- if (opts).NativeModExp }}
+	"""Compute base^exponent % modulus with the AVM bmodexp opcode."""
+	return BigUInt.from_bytes(bmodexp(base.bytes, exponent.bytes, modulus.bytes))
+{{- else }}
+	"""Compute base^exponent % modulus, processing the exponent in windows of
+	   4 bits from the most significant one."""
+	# table holds base^i % modulus for i in 0..15, 32 bytes each
+	table = UInt256(1).bytes
+	power = BigUInt(1)
+	for _i in urange(15):
+		power = (power * base) % modulus
+		table += UInt256(power).bytes
+	e = UInt256(exponent).bytes
 	result = BigUInt(1)
-	while exponent > 0:
-		if exponent % 2 == 1:
-			result = (result * base) % modulus
-		exponent = exponent // 2
-		base = (base * base) % modulus
+	started = False
+	for i in urange(64):
+		window = getbyte(e, i // 2)
+		if i % 2 == 0:
+			window = window >> 4
+		else:
+			window = window & 15
+		# squaring is skipped until the first non zero window
+		if started:
+			for _j in urange(4):
+				result = (result * result) % modulus
+		if window != 0:
+			entry = BigUInt.from_bytes(table[window * 32:window * 32 + 32])
+			result = (result * entry) % modulus
+			started = True
 	return result
+{{- end }}
 
 @subroutine
-def curvemod(x: Bytes) -> BigUInt:
+def {{ ns }}curvemod(x: Bytes) -> BigUInt:
 	"""Compute x % R_MOD."""
-	return BigUInt.from_bytes(x) % BigUInt(R_MOD)
+	return BigUInt.from_bytes(x) % BigUInt({{ ns }}R_MOD)
 
 @subroutine
-def invert(p : Bytes) -> Bytes:
+def {{ ns }}invert(p : Bytes) -> Bytes:
 	"""Invert a point on the curve."""
 	x = p[:48]
 	y = BigUInt.from_bytes(p[48:])
 	if y == BigUInt(0):
 		return p
-	neg_y = BigUInt(P_MOD) - y
+	neg_y = BigUInt({{ ns }}P_MOD) - y
 	return x + (bzero(48) | (neg_y).bytes)
 
 @subroutine
-def fs(p: Bytes) -> Bytes:
+def {{ ns }}fs(p: Bytes) -> Bytes:
 	"""If p is the point at infinity, mask the first bit with 1
 	to match gnark's encoding for the fiat-shamir challenge."""
 	if p == bzero(96):
@@ -407,7 +550,7 @@ def fs(p: Bytes) -> Bytes:
 	return p
 {{ if gt (len .CommitmentConstraintIndexes) 0 }}
 @subroutine
-def hash_fr(p: Bytes) -> BigUInt:
+def {{ ns }}hash_fr(p: Bytes) -> BigUInt:
 	"""Hash a curve point to a field element, matching gnark's fr.Hash with
 	   domain separator 'BSB22-Plonk' (sha256-based expand_msg_xmd, 48 bytes)."""
 	dst_prime = Bytes(b'BSB22-Plonk\x0b')
@@ -416,7 +559,15 @@ def hash_fr(p: Bytes) -> BigUInt:
 	b2 = sha256((b0 ^ b1) + Bytes(b'\x02') + dst_prime)
 	# interpret b1 + b2[:16] as a 48-byte big-endian integer mod R_MOD
 	res = (BigUInt.from_bytes(b1)
-		   * BigUInt(340282366920938463463374607431768211456)) % BigUInt(R_MOD)
-	return (res + BigUInt.from_bytes(b2[:16])) % BigUInt(R_MOD)
+		   * BigUInt(340282366920938463463374607431768211456)) % BigUInt({{ ns }}R_MOD)
+	return (res + BigUInt.from_bytes(b2[:16])) % BigUInt({{ ns }}R_MOD)
 {{ end -}}
+{{- define "groupArgs" }}
+	# read proof and public inputs from the app call at position {{ (opts).GroupIndex }} of the
+	# group, passed in to an arc4 contract as DynamicArray[Bytes32], so we skip
+	# the first 2 bytes which encode the length of the array
+	args_txn = py.gtxn.ApplicationCallTransaction({{ (opts).GroupIndex }})
+	proof = args_txn.app_args({{ (opts).ProofArg }})[2:]
+	public_inputs = args_txn.app_args({{ (opts).PublicInputsArg }})[2:]
+{{- end -}}
 `
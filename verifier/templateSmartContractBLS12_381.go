@@ -7,7 +7,7 @@ import typing
 import algopy as py
 from algopy import subroutine, BigUInt, Bytes, arc4, UInt64, urange
 from algopy.arc4 import UInt256, abimethod, DynamicArray, StaticArray, String
-from algopy.op import bzero, sha256, EllipticCurve as ec, EC, setbit_bytes
+from algopy.op import bzero, sha256, {{ if (opts).NativeModExp }}bmodexp{{ else }}getbyte{{ end }}, EllipticCurve as ec, EC, setbit_bytes
 
 Bytes32: typing.TypeAlias = StaticArray[arc4.Byte, typing.Literal[32]]
 
@@ -32,12 +32,61 @@ G1_SRS_Y = {{ fpstr .Kzg.G1.Y }}
 ######################################################
 
 
-class {{ (contractName) }}(py.ARC4Contract):
+{{ if (opts).Resumable -}}
+# rounds after which an incomplete verification session can be deleted
+SESSION_TIMEOUT = 1000
+
+# minimum balance of a session box, 2,500 plus 400 microalgos per byte of its
+# 33-byte name and 232-byte progress, deposited by the caller of verify_start
+# and refunded when the session is deleted
+SESSION_DEPOSIT = 108_500
+
+{{ end -}}
+{{ if (opts).Nullifier -}}
+# minimum balance of a nullifier box, 2,500 plus 400 microalgos per byte of its
+# 33-byte name and 8-byte round, paid by the caller spending the nullifier with
+# the payment preceding its app call
+NULLIFIER_DEPOSIT = 18_900
+
+{{ end -}}
+{{ if (opts).FailureReasons -}}
+# reasons returned by verify_with_reason
+{{ range failureReasons -}}
+{{ . }} = {{ printf "%d" . }}
+{{ end }}
+{{ end -}}
+{{ if (opts).BoxInputs -}}
+# number of 32-byte values of the proof and public inputs uploaded to a box
+UPLOAD_PROOF_LENGTH = {{ add 33 (mul 4 (len .CommitmentConstraintIndexes)) }}
+UPLOAD_PUBLIC_INPUTS_LENGTH = {{ (nbInputs) }}
+
+# minimum balance of an upload box, 2,500 plus 400 microalgos per byte of its
+# 33-byte name and of the proof and public inputs, deposited by the caller of
+# start_upload and refunded when the upload is deleted
+UPLOAD_DEPOSIT = {{ uploadDeposit }}
+
+{{ end -}}class {{ (contractName) }}(py.ARC4Contract{{ if (opts).AVMVersion }}, avm_version={{ (opts).AVMVersion }}{{ end }}):
+{{- if or (opts).Resumable (opts).Nullifier }}
+	def __init__(self) -> None:
+{{- if (opts).Resumable }}
+		# verification sessions in progress, keyed by the hash of proof and
+		# public inputs, holding the start round, the account that paid the
+		# deposit and the verification progress
+		self.sessions = py.BoxMap(Bytes, Bytes, key_prefix=b"s")
+{{- end }}
+{{- if (opts).Nullifier }}
+		# nullifiers of the verified proofs, holding the round they were used
+		self.nullifiers = py.BoxMap(Bytes, Bytes, key_prefix=b"n")
+{{- end }}
+{{ end }}
 	@abimethod(create='require')
-	def create(self, name: String) -> None:
-		"""On creation, save application name in global state"""
+	def create(self, name: String{{ if (opts).StateRoot }}, state_root: Bytes32{{ end }}) -> None:
+		"""On creation, save application name{{ if (opts).StateRoot }} and initial state root{{ end }} in global state"""
 		self.app_name = name
 		self.immutable = False
+{{- if (opts).StateRoot }}
+		self.state_root = state_root.copy()
+{{- end }}
 
 	@abimethod(allow_actions=["UpdateApplication", "DeleteApplication"])
 	def update(self) -> None:
@@ -51,91 +100,187 @@ class {{ (contractName) }}(py.ARC4Contract):
 		"""Creator can make the contract immutable."""
 		assert py.Global.creator_address == py.Txn.sender
 		self.immutable = True
+{{- if (opts).Nullifier }}
+
+	@abimethod(readonly=True)
+	def is_spent(self, nullifier: Bytes32) -> arc4.Bool:
+		"""Return whether a proof with the given nullifier was already verified."""
+		return arc4.Bool(nullifier.bytes in self.nullifiers)
+{{- end }}
+{{- if (opts).BoxInputs }}
 
 	@abimethod
-	def verify(self,
-	           proof: DynamicArray[Bytes32],
-			   public_inputs: DynamicArray[Bytes32],
-			   ) -> arc4.Bool:
-		"""Verify the proof for the given public inputs.
-		   Return a boolean indicating whether the proof is valid"""
+	def start_upload(self, deposit: py.gtxn.PaymentTransaction) -> None:
+		"""Create the box the sender uploads the proof and public inputs to,
+		   with deposit paying its minimum balance to the app account.
+		   Fail if the sender already has an upload in progress"""
+		assert deposit.receiver == py.Global.current_application_address
+		assert deposit.amount == UPLOAD_DEPOSIT
+		upload = py.Box(Bytes, key=b"u" + py.Txn.sender.bytes)
+		assert not upload
+		upload.create(size=(UPLOAD_PROOF_LENGTH + UPLOAD_PUBLIC_INPUTS_LENGTH) * 32)
 
-		q = BigUInt(R_MOD)
+	@abimethod
+	def upload(self, offset: arc4.UInt64, chunk: arc4.DynamicBytes) -> None:
+		"""Write chunk at offset of the proof followed by the public inputs
+		   the sender uploads for verify_uploaded, after start_upload."""
+		upload = py.Box(Bytes, key=b"u" + py.Txn.sender.bytes)
+		upload.replace(offset.native, chunk.native)
 
-		# check proof and public inputs lengths
-		assert proof.length == {{ add 33 (mul 4 (len .CommitmentConstraintIndexes)) }}
-		assert public_inputs.length == {{ .NbPublicVariables }}
+	@abimethod
+	def delete_upload(self) -> None:
+		"""Delete the proof and public inputs uploaded by the sender,
+		   refunding the deposit."""
+		del py.Box(Bytes, key=b"u" + py.Txn.sender.bytes).value
+		self.refund_upload()
+
+	@subroutine
+	def refund_upload(self) -> None:
+		"""Refund the deposit of a deleted upload to its sender, the inner
+		   transaction fee being paid by the app call."""
+		py.itxn.Payment(receiver=py.Txn.sender, amount=UPLOAD_DEPOSIT,
+						fee=0).submit()
 
-		### Read verifying key ###
-		VK_NB_PUBLIC_INPUTS = UInt64({{ .NbPublicVariables }})
-		VK_DOMAIN_SIZE = BigUInt({{ .Size }})
-		VK_INV_DOMAIN_SIZE = BigUInt({{ (frstr .SizeInv) }})
-		VK_OMEGA = BigUInt({{ (frstr .Generator) }})
+	@abimethod
+	def verify_uploaded(self) -> arc4.Bool:
+		"""Verify the proof for the public inputs uploaded by the sender,
+		   deleting them and refunding the deposit.
+		   Return a boolean indicating whether the proof is valid"""
+		upload = py.Box(Bytes, key=b"u" + py.Txn.sender.bytes)
+		data = upload.value
+		del upload.value
+		self.refund_upload()
+		proof = DynamicArray[Bytes32].from_bytes(
+			py.op.itob(UPLOAD_PROOF_LENGTH)[6:] + data[:UPLOAD_PROOF_LENGTH * 32])
+		public_inputs = DynamicArray[Bytes32].from_bytes(
+			py.op.itob(UPLOAD_PUBLIC_INPUTS_LENGTH)[6:] + data[UPLOAD_PROOF_LENGTH * 32:])
+		return self.verify{{ if (opts).TypedPublicInputs }}_proof{{ end }}(proof, public_inputs)
+{{- end }}
+{{- if (opts).Resumable }}
 
-		VK_QL = Bytes.from_hex("{{ hex .Ql }}")
-		VK_QR = Bytes.from_hex("{{ hex .Qr }}")
-		VK_QO = Bytes.from_hex("{{ hex .Qo }}")
-		VK_QM = Bytes.from_hex("{{ hex .Qm }}")
-		VK_QK = Bytes.from_hex("{{ hex .Qk }}")
+	@abimethod
+	def delete_session(self, session: Bytes32) -> None:
+		"""Delete a verification session started with verify_start and not
+		   completed within SESSION_TIMEOUT rounds, refunding its deposit."""
+		progress = self.sessions[session.bytes]
+		assert py.Global.round > py.op.btoi(progress[:8]) + SESSION_TIMEOUT
+		del self.sessions[session.bytes]
+		self.refund_deposit(progress)
+
+	@subroutine
+	def refund_deposit(self, progress: Bytes) -> None:
+		"""Refund the deposit of a deleted session to the account that paid
+		   it, the inner transaction fee being paid by the app call."""
+		py.itxn.Payment(receiver=py.Account(progress[8:40]),
+						amount=SESSION_DEPOSIT, fee=0).submit()
 
-		{{range $index, $element := .S -}}
-		VK_S{{ inc $index }} = Bytes.from_hex("{{ hex $element }}")
-		{{ end }}
-		VK_COSET_SHIFT = BigUInt({{ (frstr .CosetShift) }})
+	@abimethod
+	def verify_start(self,
+			   deposit: py.gtxn.PaymentTransaction,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Start the verification of the proof for the given public inputs,
+		   to be completed by verify_finish, with deposit paying the minimum
+		   balance of the session box to the app account.
+		   Return False, refunding the deposit, if the proof or the public
+		   inputs are malformed. Fail if the session is already started"""
+		assert deposit.receiver == py.Global.current_application_address
+		assert deposit.amount == SESSION_DEPOSIT
+		assert sha256(proof.bytes + public_inputs.bytes) not in self.sessions
+		if not self.start_session(proof, public_inputs, deposit.sender).native:
+			py.itxn.Payment(receiver=deposit.sender, amount=SESSION_DEPOSIT,
+							fee=0).submit()
+			return arc4.Bool(False)
+		return arc4.Bool(True)
 
-		{{ range $index, $element := .Qcp -}}
-		VK_QCP_{{ $index }} = Bytes.from_hex("{{ hex $element }}")
-		{{ end }}
-		# Read the fiat-shamir values of the verifying key to match gnark's encoding of the point at infinity
-		VK_QL_fs = Bytes.from_hex("{{ hexEncoded .Ql }}")
-		VK_QR_fs = Bytes.from_hex("{{ hexEncoded .Qr }}")
-		VK_QO_fs = Bytes.from_hex("{{ hexEncoded .Qo }}")
-		VK_QM_fs = Bytes.from_hex("{{ hexEncoded .Qm }}")
-		VK_QK_fs = Bytes.from_hex("{{ hexEncoded .Qk }}")
-		{{range $index, $element := .S }}
-		VK_S{{ inc $index }}_fs = Bytes.from_hex("{{ hexEncoded $element }}")
-		{{ end }}
-		{{ range $index, $element := .Qcp -}}
-		VK_QCP_{{ $index }}_fs = Bytes.from_hex("{{ hexEncoded $element }}")
-		{{ end }}
+	@subroutine
+	def start_session(self,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   depositor: py.Account,
+			   ) -> arc4.Bool:
+		"""Check the proof and public inputs and save the progress of their
+		   verification in a new session paid by depositor.
+		   Return False if the proof or the public inputs are malformed"""
+{{- else if (opts).FailureReasons }}
 
-		### Read proof ###
-		# wires commitments
-		L_COM = proof[0].bytes + proof[1].bytes + proof[2].bytes
-		R_COM = proof[3].bytes + proof[4].bytes + proof[5].bytes
-		O_COM = proof[6].bytes + proof[7].bytes + proof[8].bytes
+	@abimethod
+	def verify(self,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Verify the proof for the given public inputs.
+		   Return a boolean indicating whether the proof is valid"""
+		return arc4.Bool(self.verify_with_reason(proof, public_inputs).native == VERIFIED)
 
-		# h = h_0 + x^{n+2}h_1 + x^{2(n+2)}h_2
-		H_0 = proof[9].bytes + proof[10].bytes + proof[11].bytes
-		H_1 = proof[12].bytes + proof[13].bytes + proof[14].bytes
-		H_2 = proof[15].bytes + proof[16].bytes + proof[17].bytes
+	@abimethod
+	def verify_with_reason(self,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.UInt8:
+		"""Verify the proof for the given public inputs.
+		   Return VERIFIED if the proof is valid, the reason it is not otherwise"""
+{{- else if (opts).TypedPublicInputs }}
 
-		# wire values at zeta
-		L_AT_Z = proof[18].copy()
-		R_AT_Z = proof[19].copy()
-		O_AT_Z = proof[20].copy()
+	@abimethod
+	def verify(self,
+	           proof: DynamicArray[Bytes32],
+{{- range typedInputs }}
+			   {{ .Name }}: {{ pyType . }},
+{{- end }}
+			   ) -> arc4.Bool:
+		"""Verify the proof for the given public inputs.
+		   Return a boolean indicating whether the proof is valid"""
+		return self.verify_proof(proof, DynamicArray[Bytes32].from_bytes(
+			py.op.itob({{ (nbInputs) }})[6:]{{ range typedInputs }} + {{ .Name }}.bytes{{ end }}))
 
-		S1_AT_Z = proof[21].copy() 						  # s1(zeta)
-		S2_AT_Z = proof[22].copy() 						  # s2(zeta)
-		# z(x)
-		GRAND_PRODUCT = proof[23].bytes + proof[24].bytes + proof[25].bytes
-		GRAND_PRODUCT_AT_Z_OMEGA = proof[26].copy()       # z(w*zeta)
+	@subroutine
+	def verify_proof(self,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Verify the proof for the given public inputs.
+		   Return a boolean indicating whether the proof is valid"""
+{{- else }}
 
-		# Folded proof for opening of linear poly, l, r, o, s1, s2
-		BATCH_OPENING_AT_Z = proof[27].bytes + proof[28].bytes + proof[29].bytes
+	@abimethod
+	def verify(self,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Verify the proof for the given public inputs.
+		   Return a boolean indicating whether the proof is valid"""
+{{- end }}
+{{- if (opts).OpUp }}
 
-		# opening at zeta * omega
-		OPENING_AT_Z_OMEGA = proof[30].bytes + proof[31].bytes + proof[32].bytes
+		# raise the opcode budget with inner app calls paid by the fee of this call
+		py.ensure_budget({{ opUpBudget }}, py.OpUpFeeSource.GroupCredit)
+{{- end }}
 
-		{{ if gt (len .CommitmentConstraintIndexes) 0 -}}
-		# BSB22 commitments: all qcp_i(zeta) openings first, then the commitment points
-		{{ end -}}
-		{{ range $index, $element := .CommitmentConstraintIndexes -}}
-		QCP_{{ $index }}_AT_Z = proof[{{ add 33 $index }}].bytes
-		{{ end -}}
-		{{ range $index, $element := .CommitmentConstraintIndexes -}}
-		BSB_COM_{{ $index }} = proof[{{ add (add 33 (len $.CommitmentConstraintIndexes)) (mul $index 3) }}].bytes + proof[{{ add (add 34 (len $.CommitmentConstraintIndexes)) (mul $index 3) }}].bytes + proof[{{ add (add 35 (len $.CommitmentConstraintIndexes)) (mul $index 3) }}].bytes
-		{{ end }}
+		q = BigUInt(R_MOD)
+
+		# check proof and public inputs lengths
+{{- if (opts).FailureReasons }}
+		if (proof.length != {{ add 33 (mul 4 (len .CommitmentConstraintIndexes)) }}
+				or public_inputs.length != {{ (nbInputs) }}):
+			{{ reject "MALFORMED_INPUT" }}
+{{- else }}
+		assert proof.length == {{ add 33 (mul 4 (len .CommitmentConstraintIndexes)) }}
+		assert public_inputs.length == {{ (nbInputs) }}
+{{- end }}
+{{- if or (opts).Nullifier (opts).StateRoot (opts).DomainSeparation }}
+{{ template "checkState" . }}
+{{- end }}
+{{- if (opts).HashedPublicInputs }}
+
+		# the circuit exposes the MiMC digest of the public inputs as its only
+		# public input
+		digest = DynamicArray[Bytes32](Bytes32.from_bytes(py.op.mimc(
+			py.op.MiMCConfigurations.BLS12_381Mp111, public_inputs.bytes[2:])))
+{{- end }}
+
+		{{ template "readVkAndProof" . }}
 		### check proof public inputs are well-formed ###
 		if (BigUInt.from_bytes(L_AT_Z.bytes) >= q
 				or BigUInt.from_bytes(R_AT_Z.bytes) >= q
@@ -148,21 +293,46 @@ class {{ (contractName) }}(py.ARC4Contract):
 				{{- end }}
 		):
 			{{/*}}py.log("error: invalid proof"){{*/ -}}
-			return arc4.Bool(False)
+			{{ reject "NON_CANONICAL_PROOF" }}
+
+		{{ if unrolled .NbPublicVariables -}}
+		{{ range $i := .NbPublicVariables -}}
+		public_input_{{ $i }} = BigUInt.from_bytes({{ (inputs) }}[{{ $i }}].bytes)
+		if public_input_{{ $i }} >= q:
+			{{ reject "NON_CANONICAL_PUBLIC_INPUT" }}
 
-		for i in urange(public_inputs.length):
-			if BigUInt.from_bytes(public_inputs[i].bytes) >= q:
+		{{ end -}}
+		{{ else -}}
+		for i in urange({{ (inputs) }}.length):
+			if BigUInt.from_bytes({{ (inputs) }}[i].bytes) >= q:
 				{{/*}}py.log(b"error: invalid public inputs"){{*/ -}}
-				return arc4.Bool(False)
+				{{ reject "NON_CANONICAL_PUBLIC_INPUT" }}
 
+		{{ end -}}
+		{{ if (opts).SubgroupChecks -}}
+		### check proof points are on the curve and in the prime-order subgroup ###
+		if not (ec.subgroup_check(EC.BLS12_381g1, L_COM)
+				and ec.subgroup_check(EC.BLS12_381g1, R_COM)
+				and ec.subgroup_check(EC.BLS12_381g1, O_COM)
+				and ec.subgroup_check(EC.BLS12_381g1, H_0)
+				and ec.subgroup_check(EC.BLS12_381g1, H_1)
+				and ec.subgroup_check(EC.BLS12_381g1, H_2)
+				and ec.subgroup_check(EC.BLS12_381g1, GRAND_PRODUCT)
+				and ec.subgroup_check(EC.BLS12_381g1, BATCH_OPENING_AT_Z)
+				and ec.subgroup_check(EC.BLS12_381g1, OPENING_AT_Z_OMEGA)
+				{{- range $index, $element := .CommitmentConstraintIndexes }}
+				and ec.subgroup_check(EC.BLS12_381g1, BSB_COM_{{ $index }})
+				{{- end }}
+		):
+			{{ reject "INVALID_POINT" }}
+
+		{{ end -}}
 		### Verify the proof ###
 
 		# Compute the fiat-shamir challenges as the prover (gnark).
 		# After deriving all challenges, we need to make them modulo R_MOD.
 
-		public_inputs_bytes = Bytes(b'')
-		for i in urange(public_inputs.length):
-			public_inputs_bytes += public_inputs[i].bytes
+		public_inputs_bytes = {{ (inputs) }}.bytes[2:]
 
 		gamma_pre = sha256(b'gamma' + VK_S1_fs + VK_S2_fs + VK_S3_fs + VK_QL_fs
 					+ VK_QR_fs + VK_QM_fs + VK_QO_fs + VK_QK_fs{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}_fs{{ end }} + public_inputs_bytes
@@ -182,6 +352,41 @@ class {{ (contractName) }}(py.ARC4Contract):
 		# zn is Zz * 1/n
 		zn = (Zz * VK_INV_DOMAIN_SIZE) % q
 
+		{{ if unrolled .NbPublicVariables -}}
+		# Interpolate the public inputs (PI) with unrolled code: the Lagrange
+		# polynomial of public input i at zeta is omega^i * zn / (zeta - omega^i),
+		# with the powers of omega computed at code generation
+		{{ if gt .NbPublicVariables 0 -}}
+		# The d_i = zeta - omega^i are inverted together, and 1 / d_0 = 1 / (zeta - 1)
+		# is reused for alpha2Lagrange
+		{{ range $i := .NbPublicVariables -}}
+		d_{{ $i }} = (zeta + q - BigUInt({{ frpow $.Generator $i }})) % q
+		{{ end -}}
+		p_0 = d_0
+		{{ range $i := (sub .NbPublicVariables 1) -}}
+		p_{{ inc $i }} = (p_{{ $i }} * d_{{ inc $i }}) % q
+		{{ end -}}
+		inv = expmod(p_{{ sub .NbPublicVariables 1 }}, q - BigUInt(2), q)
+		{{ range $j := (sub .NbPublicVariables 1) -}}
+		{{ $i := sub (sub $.NbPublicVariables 1) $j -}}
+		inv_{{ $i }} = (inv * p_{{ sub $i 1 }}) % q
+		inv = (inv * d_{{ $i }}) % q
+		{{ end -}}
+		inv_0 = inv
+
+		{{ range $i := .NbPublicVariables -}}
+		{{ if eq $i 0 -}}
+		PI = (public_input_0 * inv_0) % q
+		{{ else -}}
+		tmp = (public_input_{{ $i }} * BigUInt({{ frpow $.Generator $i }})) % q
+		PI = (PI + ((tmp * inv_{{ $i }}) % q)) % q
+		{{ end -}}
+		{{ end -}}
+		PI = (PI * zn) % q
+		{{ else -}}
+		PI = BigUInt(0)
+		{{ end -}}
+		{{ else -}}
 		# Let's prepare to interpolate the public inputs
 		w_ = BigUInt(1)
 		batch = DynamicArray[UInt256]()
@@ -219,23 +424,67 @@ class {{ (contractName) }}(py.ARC4Contract):
 		PI = BigUInt(0)
 		for i in urange(VK_NB_PUBLIC_INPUTS):
 			tmp = (BigUInt.from_bytes(batch[i].bytes)
-				   * BigUInt.from_bytes(public_inputs[i].bytes)) % q
+				   * BigUInt.from_bytes({{ (inputs) }}[i].bytes)) % q
 			PI = (PI + tmp) % q
+		{{ end -}}
 		{{ range $index, $element := .CommitmentConstraintIndexes }}
 		# add the contribution of BSB22 commitment {{ $index }} to the public inputs:
 		# hash_fr(BSB_COM_{{ $index }}) * L_{{ add $.NbPublicVariables $element }}(zeta)
-		w_pow = expmod(VK_OMEGA, BigUInt({{ add $.NbPublicVariables $element }}), q)
+		w_pow = BigUInt({{ frpow $.Generator (add $.NbPublicVariables $element) }})
 		tmp = expmod((zeta + q - w_pow) % q, q - BigUInt(2), q)
 		tmp = (tmp * ((w_pow * zn) % q)) % q
 		PI = (PI + ((hash_fr(fs(BSB_COM_{{ $index }})) * tmp) % q)) % q
 		{{ end }}
 		# compute alpha2Lagrange: alpha**2 * (z**n - 1) / (z - 1)
+		{{ if and (unrolled .NbPublicVariables) (gt .NbPublicVariables 0) -}}
+		res = inv_0
+		{{ else -}}
 		res = (zeta + q - BigUInt(1)) % q
 		res = expmod(res, q - BigUInt(2), q)
+		{{ end -}}
 		res = (res * zn) % q
 		res = (res * alpha) % q
 		res = (res * alpha) % q
 		alpha2Lagrange = res
+{{- if (opts).Resumable }}
+
+		# save the progress of the verification, which verify_finish completes
+		session = sha256(proof.bytes + public_inputs.bytes)
+		self.sessions[session] = (py.op.itob(py.Global.round) + depositor.bytes
+			+ UInt256(gamma).bytes + UInt256(beta).bytes + UInt256(alpha).bytes
+			+ UInt256(zeta).bytes + UInt256(PI).bytes
+			+ UInt256(alpha2Lagrange).bytes)
+		return arc4.Bool(True)
+
+	@abimethod
+	def verify_finish(self,
+	           proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Complete the verification of the proof for the given public inputs
+		   started by verify_start.
+		   Return a boolean indicating whether the proof is valid.
+		   Fail if the verification was not started"""
+
+		q = BigUInt(R_MOD)
+
+		{{ template "readVkAndProof" . }}
+		# resume the verification from the progress saved by verify_start,
+		# deleting the session since this call completes it
+		session = sha256(proof.bytes + public_inputs.bytes)
+		progress = self.sessions[session]
+		del self.sessions[session]
+		self.refund_deposit(progress)
+		gamma = BigUInt.from_bytes(progress[40:72])
+		beta = BigUInt.from_bytes(progress[72:104])
+		alpha = BigUInt.from_bytes(progress[104:136])
+		zeta = BigUInt.from_bytes(progress[136:168])
+		PI = BigUInt.from_bytes(progress[168:200])
+		alpha2Lagrange = BigUInt.from_bytes(progress[200:232])
+{{- if or (opts).Nullifier (opts).StateRoot (opts).DomainSeparation }}
+{{ template "checkState" . }}
+{{- end }}
+{{- end }}
 
 		# verify opening linearization polynomial
 		s1 = (BigUInt.from_bytes(S1_AT_Z.bytes) * beta) % q
@@ -254,16 +503,14 @@ class {{ (contractName) }}(py.ARC4Contract):
 		s1 = (s1 + PI + q - alpha2Lagrange)  % q
 		linearized_poly_at_z = (q - s1)
 
-		# compute the folded commitment to H
+		# compute the scalars to fold the commitment to H into the commitment to the
+		# linearization polynomial: -(zeta^n - 1) * (H_0 + zeta^(n+2) H_1 + zeta^2(n+2) H_2)
 		n2 = VK_DOMAIN_SIZE + BigUInt(2)
 		zn2 = expmod(zeta, n2, q)
-		folded_h = ec.scalar_mul(EC.BLS12_381g1, H_2, zn2.bytes)
-		folded_h = ec.add(EC.BLS12_381g1, folded_h, H_1)
-		folded_h = ec.scalar_mul(EC.BLS12_381g1, folded_h, zn2.bytes)
-		folded_h = ec.add(EC.BLS12_381g1, folded_h, H_0)
 		znminus1 = (expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
-		folded_h = ec.scalar_mul(EC.BLS12_381g1, folded_h, znminus1.bytes)
-		folded_h = invert(folded_h)
+		h0 = (q - znminus1) % q
+		h1 = (h0 * zn2) % q
+		h2 = (h1 * zn2) % q
 
 		# compute commitment to linearization polynomial
 		u = (BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA.bytes) * beta) % q
@@ -290,29 +537,16 @@ class {{ (contractName) }}(py.ARC4Contract):
 		s2 = q - ((s2 * w) % q)
 		s2 = (s2 * alpha + alpha2Lagrange) % q
 
-		lin_poly_com = ec.scalar_mul(EC.BLS12_381g1, VK_QL, L_AT_Z.bytes)
-
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QR, R_AT_Z.bytes)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QO, O_AT_Z.bytes)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-
 		ab = (BigUInt.from_bytes(L_AT_Z.bytes) * BigUInt.from_bytes(R_AT_Z.bytes)) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QM, ab.bytes)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, VK_QK)
-		{{ range $index, $element := .CommitmentConstraintIndexes }}
-		add_term = ec.scalar_mul(EC.BLS12_381g1, BSB_COM_{{ $index }}, QCP_{{ $index }}_AT_Z)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-		{{ end }}
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_S3, s1.bytes)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
-
-		add_term = ec.scalar_mul(EC.BLS12_381g1, GRAND_PRODUCT, s2.bytes)
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, add_term)
 
-		lin_poly_com = ec.add(EC.BLS12_381g1, lin_poly_com, folded_h)
+		# the commitment to the linearization polynomial, including the folded
+		# commitment to H, is computed with a single multi scalar multiplication
+		lin_poly_com = ec.scalar_mul_multi(EC.BLS12_381g1,
+			VK_QL + VK_QR + VK_QO + VK_QM + VK_QK{{ range $index, $element := .CommitmentConstraintIndexes }} + BSB_COM_{{ $index }}{{ end }}
+			+ VK_S3 + GRAND_PRODUCT + H_0 + H_1 + H_2,
+			L_AT_Z.bytes + R_AT_Z.bytes + O_AT_Z.bytes + UInt256(ab).bytes + UInt256(1).bytes{{ range $index, $element := .CommitmentConstraintIndexes }} + QCP_{{ $index }}_AT_Z{{ end }}
+			+ UInt256(s1).bytes + UInt256(s2).bytes
+			+ UInt256(h0).bytes + UInt256(h1).bytes + UInt256(h2).bytes)
 
 		# generate challenge to fold the opening proofs
 		linearized_poly_at_z_bytes = bzero(32) | linearized_poly_at_z.bytes
@@ -325,66 +559,54 @@ class {{ (contractName) }}(py.ARC4Contract):
 		r_acc = r
 
 		# fold the proof in one point
-		digest = lin_poly_com
-		claims =  linearized_poly_at_z
-
-		add_term = ec.scalar_mul(EC.BLS12_381g1, L_COM, r_acc.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
+		claims = linearized_poly_at_z
 		claims = (claims + (BigUInt.from_bytes(L_AT_Z.bytes) * r_acc)) % q
+		fold_scalars = UInt256(r_acc).bytes
 
 		r_acc = (r_acc * r) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, R_COM, r_acc.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
 		claims = (claims + (BigUInt.from_bytes(R_AT_Z.bytes) * r_acc)) % q
+		fold_scalars += UInt256(r_acc).bytes
 
 		r_acc = (r_acc * r) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, O_COM, r_acc.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
 		claims = (claims + (BigUInt.from_bytes(O_AT_Z.bytes) * r_acc)) % q
+		fold_scalars += UInt256(r_acc).bytes
 
 		r_acc = (r_acc * r) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_S1, r_acc.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
 		claims = (claims + (BigUInt.from_bytes(S1_AT_Z.bytes) * r_acc)) % q
+		fold_scalars += UInt256(r_acc).bytes
 
 		r_acc = (r_acc * r) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_S2, r_acc.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
 		claims = (claims + (BigUInt.from_bytes(S2_AT_Z.bytes) * r_acc)) % q
+		fold_scalars += UInt256(r_acc).bytes
 		{{ range $index, $element := .CommitmentConstraintIndexes }}
 		r_acc = (r_acc * r) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, VK_QCP_{{ $index }}, r_acc.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
 		claims = (claims + (BigUInt.from_bytes(QCP_{{ $index }}_AT_Z) * r_acc)) % q
+		fold_scalars += UInt256(r_acc).bytes
 		{{ end }}
+		digest = ec.scalar_mul_multi(EC.BLS12_381g1,
+			lin_poly_com + L_COM + R_COM + O_COM + VK_S1 + VK_S2{{ range $index, $element := .CommitmentConstraintIndexes }} + VK_QCP_{{ $index }}{{ end }},
+			UInt256(1).bytes + fold_scalars)
+
 		# verify the folded proof
 		r_pre = sha256(digest + BATCH_OPENING_AT_Z + fs(GRAND_PRODUCT)
 				+ OPENING_AT_Z_OMEGA + UInt256(zeta).bytes + UInt256(r).bytes)
 		r = curvemod(r_pre)
 
-		quotient = BATCH_OPENING_AT_Z
-		add_term = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
-		quotient = ec.add(EC.BLS12_381g1, quotient, add_term)
-
-		add_term = ec.scalar_mul(EC.BLS12_381g1, GRAND_PRODUCT, r.bytes)
-		digest = ec.add(EC.BLS12_381g1, digest, add_term)
+		quotient = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
+		quotient = ec.add(EC.BLS12_381g1, BATCH_OPENING_AT_Z, quotient)
+		quotient = invert(quotient)
 
 		claims = (claims + (BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA.bytes)
-	       		  * r)) % q
+				  * r)) % q
 		G1_SRS = (bzero(48) | BigUInt(G1_SRS_X).bytes) + (bzero(48) | BigUInt(G1_SRS_Y).bytes)
-		claims_com = ec.scalar_mul(EC.BLS12_381g1, G1_SRS, claims.bytes)
-
-		digest = ec.add(EC.BLS12_381g1, digest, invert(claims_com))
-
-		points_quotient = ec.scalar_mul(EC.BLS12_381g1, BATCH_OPENING_AT_Z, zeta.bytes)
 
+		# add the commitment to z, subtract the commitment to the claimed values and
+		# add the points quotient, with a single multi scalar multiplication
 		zeta_omega = (zeta * VK_OMEGA) % q
-		r = (r * zeta_omega) % q
-		add_term = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
-		points_quotient = ec.add(EC.BLS12_381g1, points_quotient, add_term)
-
-		digest = ec.add(EC.BLS12_381g1, digest, points_quotient)
-		quotient = invert(quotient)
+		digest = ec.scalar_mul_multi(EC.BLS12_381g1,
+			digest + GRAND_PRODUCT + G1_SRS + BATCH_OPENING_AT_Z + OPENING_AT_Z_OMEGA,
+			UInt256(1).bytes + UInt256(r).bytes + UInt256((q - claims) % q).bytes
+			+ UInt256(zeta).bytes + UInt256((r * zeta_omega) % q).bytes)
 
 		g2 = ((bzero(48) | BigUInt(G2_SRS_0_X_1).bytes) + (bzero(48) | BigUInt(G2_SRS_0_X_0).bytes)
 		+ (bzero(48) | BigUInt(G2_SRS_0_Y_1).bytes) + (bzero(48) | BigUInt(G2_SRS_0_Y_0).bytes)
@@ -392,20 +614,93 @@ class {{ (contractName) }}(py.ARC4Contract):
 		+ (bzero(48) | BigUInt(G2_SRS_1_Y_1).bytes) + (bzero(48) | BigUInt(G2_SRS_1_Y_0).bytes))
 
 		check = ec.pairing_check(EC.BLS12_381g1, digest + quotient, g2)
+{{- if or (opts).Nullifier (opts).StateRoot (opts).VerifiedEvent (opts).PostVerifyHook }}
+		if check:
+{{- if (opts).Nullifier }}
+			# spend the nullifier so that no other proof can use it, with the
+			# payment preceding this app call paying the minimum balance of its box
+			deposit = py.gtxn.PaymentTransaction(py.Txn.group_index - 1)
+			assert deposit.receiver == py.Global.current_application_address
+			assert deposit.amount == NULLIFIER_DEPOSIT
+			self.nullifiers[public_inputs[{{ (opts).NullifierIndex }}].bytes] = py.op.itob(py.Global.round)
+{{- end }}
+{{- if (opts).StateRoot }}
+			# move to the new state root
+			self.state_root = public_inputs[{{ (opts).NewRootIndex }}].copy()
+			arc4.emit("StateTransition(byte[32],byte[32])",
+				public_inputs[{{ (opts).OldRootIndex }}], public_inputs[{{ (opts).NewRootIndex }}])
+{{- end }}
+{{- if (opts).VerifiedEvent }}
+			# announce the verified proof to indexers
+			arc4.emit("{{ verifiedEvent }}",
+				Bytes32.from_bytes(Bytes.from_hex("{{ vkHash }}")),
+				Bytes32.from_bytes(sha256(public_inputs.bytes[2:])){{ if (opts).VerifiedEventPublicInputs }},
+				public_inputs{{ end }})
+{{- end }}
+{{- if and (opts).PostVerifyHook (opts).TypedPublicInputs }}
+			self.on_verified(
+{{- $offset := 2 }}
+{{- range typedInputs }}
+				{{ pyType . }}.from_bytes(public_inputs.bytes[{{ $offset }}:{{ $offset = add $offset (mul 32 .Size) }}{{ $offset }}]),
+{{- end }}
+			)
+{{- else if (opts).PostVerifyHook }}
+			self.on_verified(public_inputs)
+{{- end }}
+{{- end }}
+{{- if (opts).FailureReasons }}
+		return arc4.UInt8(VERIFIED if check else PAIRING_FAILED)
+{{- else }}
 		return arc4.Bool(check)
+{{- end }}
+{{- if (opts).PostVerifyHook }}
+
+	@subroutine
+{{- if (opts).TypedPublicInputs }}
+	def on_verified(self{{ range typedInputs }}, {{ .Name }}: {{ pyType . }}{{ end }}) -> None:
+		"""Act on the verification of a valid proof for the given public inputs."""
+{{- else }}
+	def on_verified(self, public_inputs: DynamicArray[Bytes32]) -> None:
+		"""Act on the verification of a valid proof for public_inputs."""
+{{- end }}
+{{ indent 2 (opts).PostVerifyHook }}
+{{- end }}
 
 
 
 @subroutine
 def expmod(base: BigUInt, exponent: BigUInt, modulus: BigUInt) -> BigUInt:
-	"""Compute base^exponent % modulus."""
+{{- if (opts).NativeModExp }}
+	"""Compute base^exponent % modulus with the AVM bmodexp opcode."""
+	return BigUInt.from_bytes(bmodexp(base.bytes, exponent.bytes, modulus.bytes))
+{{- else }}
+	"""Compute base^exponent % modulus, processing the exponent in windows of
+	   4 bits from the most significant one."""
+	# table holds base^i % modulus for i in 0..15, 32 bytes each
+	table = UInt256(1).bytes
+	power = BigUInt(1)
+	for _i in urange(15):
+		power = (power * base) % modulus
+		table += UInt256(power).bytes
+	e = UInt256(exponent).bytes
 	result = BigUInt(1)
-	while exponent > 0:
-		if exponent % 2 == 1:
-			result = (result * base) % modulus
-		exponent = exponent // 2
-		base = (base * base) % modulus
+	started = False
+	for i in urange(64):
+		window = getbyte(e, i // 2)
+		if i % 2 == 0:
+			window = window >> 4
+		else:
+			window = window & 15
+		# squaring is skipped until the first non zero window
+		if started:
+			for _j in urange(4):
+				result = (result * result) % modulus
+		if window != 0:
+			entry = BigUInt.from_bytes(table[window * 32:window * 32 + 32])
+			result = (result * entry) % modulus
+			started = True
 	return result
+{{- end }}
 
 @subroutine
 def curvemod(x: Bytes) -> BigUInt:
@@ -443,4 +738,97 @@ def hash_fr(p: Bytes) -> BigUInt:
 		   * BigUInt(340282366920938463463374607431768211456)) % BigUInt(R_MOD)
 	return (res + BigUInt.from_bytes(b2[:16])) % BigUInt(R_MOD)
 {{ end -}}
+{{ define "readVkAndProof" }}### Read verifying key ###
+		VK_NB_PUBLIC_INPUTS = UInt64({{ .NbPublicVariables }})
+		VK_DOMAIN_SIZE = BigUInt({{ .Size }})
+		VK_INV_DOMAIN_SIZE = BigUInt({{ (frstr .SizeInv) }})
+		VK_OMEGA = BigUInt({{ (frstr .Generator) }})
+
+		VK_QL = Bytes.from_hex("{{ hex .Ql }}")
+		VK_QR = Bytes.from_hex("{{ hex .Qr }}")
+		VK_QO = Bytes.from_hex("{{ hex .Qo }}")
+		VK_QM = Bytes.from_hex("{{ hex .Qm }}")
+		VK_QK = Bytes.from_hex("{{ hex .Qk }}")
+
+		{{range $index, $element := .S -}}
+		VK_S{{ inc $index }} = Bytes.from_hex("{{ hex $element }}")
+		{{ end }}
+		VK_COSET_SHIFT = BigUInt({{ (frstr .CosetShift) }})
+
+		{{ range $index, $element := .Qcp -}}
+		VK_QCP_{{ $index }} = Bytes.from_hex("{{ hex $element }}")
+		{{ end }}
+		# Read the fiat-shamir values of the verifying key to match gnark's encoding of the point at infinity
+		VK_QL_fs = Bytes.from_hex("{{ hexEncoded .Ql }}")
+		VK_QR_fs = Bytes.from_hex("{{ hexEncoded .Qr }}")
+		VK_QO_fs = Bytes.from_hex("{{ hexEncoded .Qo }}")
+		VK_QM_fs = Bytes.from_hex("{{ hexEncoded .Qm }}")
+		VK_QK_fs = Bytes.from_hex("{{ hexEncoded .Qk }}")
+		{{range $index, $element := .S }}
+		VK_S{{ inc $index }}_fs = Bytes.from_hex("{{ hexEncoded $element }}")
+		{{ end }}
+		{{ range $index, $element := .Qcp -}}
+		VK_QCP_{{ $index }}_fs = Bytes.from_hex("{{ hexEncoded $element }}")
+		{{ end }}
+
+		### Read proof ###
+		# wires commitments
+		L_COM = proof[0].bytes + proof[1].bytes + proof[2].bytes
+		R_COM = proof[3].bytes + proof[4].bytes + proof[5].bytes
+		O_COM = proof[6].bytes + proof[7].bytes + proof[8].bytes
+
+		# h = h_0 + x^{n+2}h_1 + x^{2(n+2)}h_2
+		H_0 = proof[9].bytes + proof[10].bytes + proof[11].bytes
+		H_1 = proof[12].bytes + proof[13].bytes + proof[14].bytes
+		H_2 = proof[15].bytes + proof[16].bytes + proof[17].bytes
+
+		# wire values at zeta
+		L_AT_Z = proof[18].copy()
+		R_AT_Z = proof[19].copy()
+		O_AT_Z = proof[20].copy()
+
+		S1_AT_Z = proof[21].copy() 						  # s1(zeta)
+		S2_AT_Z = proof[22].copy() 						  # s2(zeta)
+		# z(x)
+		GRAND_PRODUCT = proof[23].bytes + proof[24].bytes + proof[25].bytes
+		GRAND_PRODUCT_AT_Z_OMEGA = proof[26].copy()       # z(w*zeta)
+
+		# Folded proof for opening of linear poly, l, r, o, s1, s2
+		BATCH_OPENING_AT_Z = proof[27].bytes + proof[28].bytes + proof[29].bytes
+
+		# opening at zeta * omega
+		OPENING_AT_Z_OMEGA = proof[30].bytes + proof[31].bytes + proof[32].bytes
+
+		{{ if gt (len .CommitmentConstraintIndexes) 0 -}}
+		# BSB22 commitments: all qcp_i(zeta) openings first, then the commitment points
+		{{ end -}}
+		{{ range $index, $element := .CommitmentConstraintIndexes -}}
+		QCP_{{ $index }}_AT_Z = proof[{{ add 33 $index }}].bytes
+		{{ end -}}
+		{{ range $index, $element := .CommitmentConstraintIndexes -}}
+		BSB_COM_{{ $index }} = proof[{{ add (add 33 (len $.CommitmentConstraintIndexes)) (mul $index 3) }}].bytes + proof[{{ add (add 34 (len $.CommitmentConstraintIndexes)) (mul $index 3) }}].bytes + proof[{{ add (add 35 (len $.CommitmentConstraintIndexes)) (mul $index 3) }}].bytes
+		{{ end }}{{ end }}
+{{- define "checkState" }}
+{{- if (opts).DomainSeparation }}
+		# reject the proof if it is bound to another network or application, the
+		# genesis hash split in its high and low 128 bits
+		if (public_inputs[{{ (opts).GenesisHashIndex }}].bytes
+				!= bzero(16) + py.Global.genesis_hash[:16]
+				or public_inputs[{{ add (opts).GenesisHashIndex 1 }}].bytes
+				!= bzero(16) + py.Global.genesis_hash[16:]
+				or BigUInt.from_bytes(public_inputs[{{ (opts).AppIDIndex }}].bytes)
+				!= BigUInt(py.Global.current_application_id.id)):
+			{{ reject "WRONG_DOMAIN" }}
+{{- end }}
+{{- if (opts).Nullifier }}
+		# reject the proof if its nullifier was already used
+		if public_inputs[{{ (opts).NullifierIndex }}].bytes in self.nullifiers:
+			{{ reject "SPENT_NULLIFIER" }}
+{{- end }}
+{{- if (opts).StateRoot }}
+		# reject the proof if it does not start from the current state root
+		if public_inputs[{{ (opts).OldRootIndex }}] != self.state_root:
+			{{ reject "STALE_STATE_ROOT" }}
+{{- end }}
+{{- end }}
 `
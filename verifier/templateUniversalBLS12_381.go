@@ -0,0 +1,556 @@
+package verifier
+
+const tmplUniversalVerifierBls12_381 = `# Code automatically generated - DO NOT EDIT.
+
+import typing
+
+import algopy as py
+from algopy import subroutine, BigUInt, Bytes, arc4, UInt64, urange
+from algopy.arc4 import UInt256, abimethod, DynamicArray, StaticArray, String
+from algopy.op import bzero, sha256, extract_uint64, {{ if (opts).NativeModExp }}bmodexp{{ else }}getbyte{{ end }}, EllipticCurve as ec, EC, setbit_bytes
+
+Bytes32: typing.TypeAlias = StaticArray[arc4.Byte, typing.Literal[32]]
+
+#################### Curve parameters ####################
+
+# curve order
+R_MOD = 52435875175126190479447740508185965837690552500527637822603658699938581184513
+
+# field order
+P_MOD = 4002409555221667393417789825735904156556882819939007885332058136124031650490837864442687629129015664037894272559787
+
+#################### Verifying key layout ####################
+
+# sizes in bytes of the G1 and G2 points
+G1_SIZE = 96
+G2_SIZE = 192
+
+# offsets in the serialized verifying keys, as written by
+# verifier.MarshalUniversalVerifyingKey
+VK_POINTS_OFFSET = 120
+VK_G1_SRS_OFFSET = VK_POINTS_OFFSET + 8 * G1_SIZE
+VK_G2_SRS_OFFSET = VK_G1_SRS_OFFSET + G1_SIZE
+VK_QCP_OFFSET = VK_G2_SRS_OFFSET + 2 * G2_SIZE
+
+# status byte following a registered verifying key in its box, set by
+# finalize_vk once the key is checked
+VK_PENDING = b"\x00"
+VK_FINALIZED = b"\x01"
+
+######################################################
+
+class {{ (contractName) }}(py.ARC4Contract{{ if (opts).AVMVersion }}, avm_version={{ (opts).AVMVersion }}{{ end }}):
+{{- if not . }}
+	def __init__(self) -> None:
+		# registered verifying keys, keyed by their hash and followed by their
+		# status byte
+		self.vks = py.BoxMap(Bytes, Bytes, key_prefix=b"v")
+{{ end }}
+	@abimethod(create='require')
+	def create(self, name: String) -> None:
+		"""On creation, save application name in global state"""
+		self.app_name = name
+		self.immutable = False
+
+	@abimethod(allow_actions=["UpdateApplication", "DeleteApplication"])
+	def update(self) -> None:
+		"""Creator can update and delete the application if the immutable
+		   property is false."""
+		assert not self.immutable
+		assert py.Global.creator_address == py.Txn.sender
+
+	@abimethod
+	def make_immutable(self) -> None:
+{{- if . }}
+		"""Creator can make the contract immutable."""
+{{- else }}
+		"""Creator can make the contract immutable, freezing the registered
+		   verifying keys."""
+{{- end }}
+		assert py.Global.creator_address == py.Txn.sender
+		self.immutable = True
+{{- range . }}
+
+	@abimethod
+	def verify_{{ .Name }}(self,
+			   proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Verify the proof for the given public inputs of circuit {{ .Name }}.
+		   Return a boolean indicating whether the proof is valid"""
+		return verify_proof(Bytes.from_hex("{{ .Hex }}"), proof, public_inputs)
+{{- end }}
+{{- if not . }}
+
+	@abimethod
+	def register_vk(self, vk_hash: Bytes32, size: arc4.UInt64,
+					offset: arc4.UInt64, chunk: arc4.DynamicBytes) -> None:
+		"""Creator can write chunk at offset of the verifying key of size bytes
+		   with hash vk_hash, until finalized with finalize_vk, if the immutable
+		   property is false."""
+		assert not self.immutable
+		assert py.Global.creator_address == py.Txn.sender
+		vk = py.Box(Bytes, key=b"v" + vk_hash.bytes)
+		if vk:
+			assert vk.length == size.native + 1
+			assert vk.extract(size.native, 1) == VK_PENDING
+		else:
+			vk.create(size=size.native + 1)
+		assert offset.native + chunk.native.length <= size.native
+		vk.replace(offset.native, chunk.native)
+
+	@abimethod
+	def finalize_vk(self, vk_hash: Bytes32) -> None:
+		"""Creator can finalize the verifying key with hash vk_hash, so that
+		   verify accepts it, if the immutable property is false. Fail if the
+		   written key does not have the size of its number of commitments or
+		   does not hash to vk_hash."""
+		assert not self.immutable
+		assert py.Global.creator_address == py.Txn.sender
+		vk = py.Box(Bytes, key=b"v" + vk_hash.bytes)
+		size = vk.length - 1
+		nb_commitments = extract_uint64(vk.extract(8, 8), 0)
+		assert size == VK_QCP_OFFSET + nb_commitments * (G1_SIZE + 8)
+		assert sha256(vk.extract(0, size)) == vk_hash.bytes
+		vk.replace(size, VK_FINALIZED)
+
+	@abimethod
+	def delete_vk(self, vk_hash: Bytes32) -> None:
+		"""Creator can delete the verifying key with hash vk_hash, if the
+		   immutable property is false."""
+		assert not self.immutable
+		assert py.Global.creator_address == py.Txn.sender
+		del self.vks[vk_hash.bytes]
+
+	@abimethod(readonly=True)
+	def is_registered(self, vk_hash: Bytes32) -> arc4.Bool:
+		"""Return whether the verifying key with hash vk_hash is registered
+		   and finalized."""
+		vk = py.Box(Bytes, key=b"v" + vk_hash.bytes)
+		if not vk:
+			return arc4.Bool(False)
+		return arc4.Bool(vk.extract(vk.length - 1, 1) == VK_FINALIZED)
+
+	@abimethod
+	def verify(self,
+			   vk_hash: Bytes32,
+			   proof: DynamicArray[Bytes32],
+			   public_inputs: DynamicArray[Bytes32],
+			   ) -> arc4.Bool:
+		"""Verify the proof for the given public inputs with the registered
+		   verifying key with hash vk_hash, which must be finalized.
+		   Return a boolean indicating whether the proof is valid"""
+		vk = py.Box(Bytes, key=b"v" + vk_hash.bytes)
+		size = vk.length - 1
+		assert vk.extract(size, 1) == VK_FINALIZED
+		return verify_proof(vk.extract(0, size), proof, public_inputs)
+{{- end }}
+
+
+@subroutine
+def verify_proof(vk: Bytes,
+				 proof: DynamicArray[Bytes32],
+				 public_inputs: DynamicArray[Bytes32],
+				 ) -> arc4.Bool:
+	"""Verify the proof for the given public inputs with the verifying key vk,
+	   serialized by verifier.MarshalUniversalVerifyingKey.
+	   Return a boolean indicating whether the proof is valid"""
+
+	q = BigUInt(R_MOD)
+
+	### Read verifying key ###
+	VK_NB_PUBLIC_INPUTS = extract_uint64(vk, 0)
+	VK_NB_COMMITMENTS = extract_uint64(vk, 8)
+	VK_DOMAIN_SIZE = BigUInt(extract_uint64(vk, 16))
+	VK_INV_DOMAIN_SIZE = BigUInt.from_bytes(vk[24:56])
+	VK_OMEGA = BigUInt.from_bytes(vk[56:88])
+	VK_COSET_SHIFT = BigUInt.from_bytes(vk[88:120])
+
+	# S1, S2, S3, Ql, Qr, Qm, Qo and Qk, in the order of the fiat-shamir
+	# challenge gamma. The points are stored with gnark's encoding of the
+	# point at infinity for the fiat-shamir challenges, and converted to the
+	# AVM encoding for the curve operations
+	VK_POINTS_fs = vk[VK_POINTS_OFFSET:VK_G1_SRS_OFFSET]
+	VK_POINTS = ec_points(VK_POINTS_fs)
+	VK_S1_fs = VK_POINTS_fs[0:96]
+	VK_S2_fs = VK_POINTS_fs[96:192]
+	VK_S1 = VK_POINTS[0:96]
+	VK_S2 = VK_POINTS[96:192]
+	VK_S3 = VK_POINTS[192:288]
+	VK_QL = VK_POINTS[288:384]
+	VK_QR = VK_POINTS[384:480]
+	VK_QM = VK_POINTS[480:576]
+	VK_QO = VK_POINTS[576:672]
+	VK_QK = VK_POINTS[672:768]
+	G1_SRS = vk[VK_G1_SRS_OFFSET:VK_G2_SRS_OFFSET]
+	G2_SRS = vk[VK_G2_SRS_OFFSET:VK_QCP_OFFSET]
+
+	# BSB22 commitments: the Qcp points, then their constraint indexes
+	VK_QCP_fs = vk[VK_QCP_OFFSET:VK_QCP_OFFSET + VK_NB_COMMITMENTS * G1_SIZE]
+	VK_QCP = ec_points(VK_QCP_fs)
+	VK_COMMITMENT_INDEXES = vk[VK_QCP_OFFSET + VK_NB_COMMITMENTS * G1_SIZE:]
+
+	# check proof and public inputs lengths
+	assert proof.length == 33 + 4 * VK_NB_COMMITMENTS
+	assert public_inputs.length == VK_NB_PUBLIC_INPUTS
+
+	### Read proof ###
+	# wires commitments
+	L_COM = proof[0].bytes + proof[1].bytes + proof[2].bytes
+	R_COM = proof[3].bytes + proof[4].bytes + proof[5].bytes
+	O_COM = proof[6].bytes + proof[7].bytes + proof[8].bytes
+
+	# h = h_0 + x^{n+2}h_1 + x^{2(n+2)}h_2
+	H_0 = proof[9].bytes + proof[10].bytes + proof[11].bytes
+	H_1 = proof[12].bytes + proof[13].bytes + proof[14].bytes
+	H_2 = proof[15].bytes + proof[16].bytes + proof[17].bytes
+
+	# wire values at zeta
+	L_AT_Z = proof[18].copy()
+	R_AT_Z = proof[19].copy()
+	O_AT_Z = proof[20].copy()
+
+	S1_AT_Z = proof[21].copy() 						  # s1(zeta)
+	S2_AT_Z = proof[22].copy() 						  # s2(zeta)
+	# z(x)
+	GRAND_PRODUCT = proof[23].bytes + proof[24].bytes + proof[25].bytes
+	GRAND_PRODUCT_AT_Z_OMEGA = proof[26].copy()       # z(w*zeta)
+
+	# Folded proof for opening of linear poly, l, r, o, s1, s2
+	BATCH_OPENING_AT_Z = proof[27].bytes + proof[28].bytes + proof[29].bytes
+
+	# opening at zeta * omega
+	OPENING_AT_Z_OMEGA = proof[30].bytes + proof[31].bytes + proof[32].bytes
+
+	# BSB22 commitments: all qcp_i(zeta) openings first, then the commitment points
+	QCP_AT_Z = proof.bytes[2 + 33 * 32:2 + (33 + VK_NB_COMMITMENTS) * 32]
+	BSB_COM = proof.bytes[2 + (33 + VK_NB_COMMITMENTS) * 32:]
+	BSB_COM_fs = Bytes()
+	for i in urange(VK_NB_COMMITMENTS):
+		BSB_COM_fs += fs(BSB_COM[i * G1_SIZE:i * G1_SIZE + G1_SIZE])
+
+	### check proof public inputs are well-formed ###
+	if (BigUInt.from_bytes(L_AT_Z.bytes) >= q
+			or BigUInt.from_bytes(R_AT_Z.bytes) >= q
+			or BigUInt.from_bytes(O_AT_Z.bytes) >= q
+			or BigUInt.from_bytes(S1_AT_Z.bytes) >= q
+			or BigUInt.from_bytes(S2_AT_Z.bytes) >= q
+			or BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA.bytes) >= q
+	):
+		return arc4.Bool(False)
+	for i in urange(VK_NB_COMMITMENTS):
+		if BigUInt.from_bytes(QCP_AT_Z[i * 32:i * 32 + 32]) >= q:
+			return arc4.Bool(False)
+
+	for i in urange(public_inputs.length):
+		if BigUInt.from_bytes(public_inputs[i].bytes) >= q:
+			return arc4.Bool(False)
+
+	{{ if (opts).SubgroupChecks -}}
+	### check proof points are on the curve and in the prime-order subgroup ###
+	if not (ec.subgroup_check(EC.BLS12_381g1, L_COM)
+			and ec.subgroup_check(EC.BLS12_381g1, R_COM)
+			and ec.subgroup_check(EC.BLS12_381g1, O_COM)
+			and ec.subgroup_check(EC.BLS12_381g1, H_0)
+			and ec.subgroup_check(EC.BLS12_381g1, H_1)
+			and ec.subgroup_check(EC.BLS12_381g1, H_2)
+			and ec.subgroup_check(EC.BLS12_381g1, GRAND_PRODUCT)
+			and ec.subgroup_check(EC.BLS12_381g1, BATCH_OPENING_AT_Z)
+			and ec.subgroup_check(EC.BLS12_381g1, OPENING_AT_Z_OMEGA)):
+		return arc4.Bool(False)
+	for i in urange(VK_NB_COMMITMENTS):
+		if not ec.subgroup_check(EC.BLS12_381g1, BSB_COM[i * G1_SIZE:i * G1_SIZE + G1_SIZE]):
+			return arc4.Bool(False)
+
+	{{ end -}}
+	### Verify the proof ###
+
+	# Compute the fiat-shamir challenges as the prover (gnark).
+	# After deriving all challenges, we need to make them modulo R_MOD.
+
+	public_inputs_bytes = public_inputs.bytes[2:]
+
+	gamma_pre = sha256(b'gamma' + VK_POINTS_fs + VK_QCP_fs + public_inputs_bytes
+		+ fs(L_COM) + fs(R_COM) + fs(O_COM))
+	beta_pre = sha256(b'beta' + gamma_pre)
+	alpha_pre = sha256(b'alpha' + beta_pre + BSB_COM_fs + fs(GRAND_PRODUCT))
+	zeta_pre = sha256(b'zeta' + alpha_pre + fs(H_0) + fs(H_1) + fs(H_2))
+
+	gamma = curvemod(gamma_pre)
+	beta = curvemod(beta_pre)
+	alpha = curvemod(alpha_pre)
+	zeta = curvemod(zeta_pre)
+
+	# Zz is eval of Xⁿ-1 at zeta
+	Zz = (expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
+
+	# zn is Zz * 1/n
+	zn = (Zz * VK_INV_DOMAIN_SIZE) % q
+
+	# Let's prepare to interpolate the public inputs
+	w_ = BigUInt(1)
+	batch = DynamicArray[UInt256]()
+	for i in urange(VK_NB_PUBLIC_INPUTS):
+		x = (zeta + q - w_) % q
+		batch.append(UInt256(x))
+		w_ = (w_ * VK_OMEGA) % q
+
+	# Compute batch inversion
+	temp = DynamicArray[UInt256]()
+	prev = BigUInt(1)
+	temp.append(UInt256(prev))
+	for x256 in batch:
+		x = BigUInt.from_bytes(x256.bytes)
+		y = (x * prev) % q
+		temp.append(UInt256(y))
+		prev = y
+	inv = expmod(prev, q - BigUInt(2), q)
+	i = VK_NB_PUBLIC_INPUTS
+	while i > 0:
+		tmp = BigUInt.from_bytes(batch[i-1].bytes)
+		cur = (inv * BigUInt.from_bytes(temp[i-1].bytes)) % q
+		batch[i-1] = UInt256(cur)
+		inv = (inv * tmp) % q
+		i -= 1
+
+	# We can now interpolate the public inputs (PI)
+	w_ = BigUInt(1)
+	for i in urange(VK_NB_PUBLIC_INPUTS):
+		batch[i] = UInt256((w_ * ((BigUInt.from_bytes(batch[i].bytes) * zn)
+							% q)) % q)
+		w_ = (w_ * VK_OMEGA) % q
+
+	tmp = BigUInt(0)
+	PI = BigUInt(0)
+	for i in urange(VK_NB_PUBLIC_INPUTS):
+		tmp = (BigUInt.from_bytes(batch[i].bytes)
+			   * BigUInt.from_bytes(public_inputs[i].bytes)) % q
+		PI = (PI + tmp) % q
+
+	# add the contribution of the BSB22 commitments to the public inputs:
+	# hash_fr(BSB_COM_i) * L_{nb_public_inputs + index_i}(zeta)
+	for i in urange(VK_NB_COMMITMENTS):
+		index = VK_NB_PUBLIC_INPUTS + extract_uint64(VK_COMMITMENT_INDEXES, i * 8)
+		w_pow = expmod(VK_OMEGA, BigUInt(index), q)
+		tmp = expmod((zeta + q - w_pow) % q, q - BigUInt(2), q)
+		tmp = (tmp * ((w_pow * zn) % q)) % q
+		bsb_com = BSB_COM_fs[i * G1_SIZE:i * G1_SIZE + G1_SIZE]
+		PI = (PI + ((hash_fr(bsb_com) * tmp) % q)) % q
+
+	# compute alpha2Lagrange: alpha**2 * (z**n - 1) / (z - 1)
+	res = (zeta + q - BigUInt(1)) % q
+	res = expmod(res, q - BigUInt(2), q)
+	res = (res * zn) % q
+	res = (res * alpha) % q
+	res = (res * alpha) % q
+	alpha2Lagrange = res
+
+	# verify opening linearization polynomial
+	s1 = (BigUInt.from_bytes(S1_AT_Z.bytes) * beta) % q
+	s1 = (s1 + gamma + BigUInt.from_bytes(L_AT_Z.bytes)) % q
+
+	s2 = (BigUInt.from_bytes(S2_AT_Z.bytes) * beta) % q
+	s2 = (s2 + gamma + BigUInt.from_bytes(R_AT_Z.bytes)) % q
+
+	o = (BigUInt.from_bytes(O_AT_Z.bytes) + gamma) % q
+
+	s1 = (s1 * s2) % q
+	s1 = (s1 * o) % q
+	s1 = (s1 * alpha) % q
+	s1 = (s1 * BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA.bytes)) % q
+
+	s1 = (s1 + PI + q - alpha2Lagrange)  % q
+	linearized_poly_at_z = (q - s1)
+
+	# compute the scalars to fold the commitment to H into the commitment to the
+	# linearization polynomial: -(zeta^n - 1) * (H_0 + zeta^(n+2) H_1 + zeta^2(n+2) H_2)
+	n2 = VK_DOMAIN_SIZE + BigUInt(2)
+	zn2 = expmod(zeta, n2, q)
+	znminus1 = (expmod(zeta, VK_DOMAIN_SIZE, q) + q - BigUInt(1)) % q
+	h0 = (q - znminus1) % q
+	h1 = (h0 * zn2) % q
+	h2 = (h1 * zn2) % q
+
+	# compute commitment to linearization polynomial
+	u = (BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA.bytes) * beta) % q
+	v = (BigUInt.from_bytes(S1_AT_Z.bytes) * beta) % q
+	v = (v + BigUInt.from_bytes(L_AT_Z.bytes) + gamma) % q
+	w  = (BigUInt.from_bytes(S2_AT_Z.bytes) * beta) % q
+	w = (w + BigUInt.from_bytes(R_AT_Z.bytes) + gamma) % q
+
+	s1 = (u * v) % q
+	s1 = (s1 * w) % q
+	s1 = (s1 * alpha) % q
+
+	coset_square = (VK_COSET_SHIFT * VK_COSET_SHIFT) % q
+	betazeta = (beta * zeta) % q
+	u = (betazeta + BigUInt.from_bytes(L_AT_Z.bytes) + gamma) % q
+
+	v = (betazeta * VK_COSET_SHIFT) % q
+	v = (v + BigUInt.from_bytes(R_AT_Z.bytes) + gamma) % q
+
+	w = (betazeta * coset_square) % q
+	w = (w + BigUInt.from_bytes(O_AT_Z.bytes) + gamma) % q
+
+	s2 = (u * v) % q
+	s2 = q - ((s2 * w) % q)
+	s2 = (s2 * alpha + alpha2Lagrange) % q
+
+	ab = (BigUInt.from_bytes(L_AT_Z.bytes) * BigUInt.from_bytes(R_AT_Z.bytes)) % q
+
+	# the commitment to the linearization polynomial, including the folded
+	# commitment to H, is computed with a single multi scalar multiplication
+	lin_poly_com = ec.scalar_mul_multi(EC.BLS12_381g1,
+		VK_QL + VK_QR + VK_QO + VK_QM + VK_QK + BSB_COM
+		+ VK_S3 + GRAND_PRODUCT + H_0 + H_1 + H_2,
+		L_AT_Z.bytes + R_AT_Z.bytes + O_AT_Z.bytes + UInt256(ab).bytes + UInt256(1).bytes + QCP_AT_Z
+		+ UInt256(s1).bytes + UInt256(s2).bytes
+		+ UInt256(h0).bytes + UInt256(h1).bytes + UInt256(h2).bytes)
+
+	# generate challenge to fold the opening proofs
+	linearized_poly_at_z_bytes = bzero(32) | linearized_poly_at_z.bytes
+	r_pre = sha256(b'gamma' + UInt256(zeta).bytes + lin_poly_com
+		 + fs(L_COM) + fs(R_COM) + fs(O_COM) + VK_S1_fs + VK_S2_fs + VK_QCP_fs
+		 + linearized_poly_at_z_bytes + L_AT_Z.bytes + R_AT_Z.bytes
+		 + O_AT_Z.bytes + S1_AT_Z.bytes + S2_AT_Z.bytes + QCP_AT_Z
+		 + GRAND_PRODUCT_AT_Z_OMEGA.bytes)
+	r = curvemod(r_pre)
+	r_acc = r
+
+	# fold the proof in one point
+	claims = linearized_poly_at_z
+	claims = (claims + (BigUInt.from_bytes(L_AT_Z.bytes) * r_acc)) % q
+	fold_scalars = UInt256(r_acc).bytes
+
+	r_acc = (r_acc * r) % q
+	claims = (claims + (BigUInt.from_bytes(R_AT_Z.bytes) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
+
+	r_acc = (r_acc * r) % q
+	claims = (claims + (BigUInt.from_bytes(O_AT_Z.bytes) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
+
+	r_acc = (r_acc * r) % q
+	claims = (claims + (BigUInt.from_bytes(S1_AT_Z.bytes) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
+
+	r_acc = (r_acc * r) % q
+	claims = (claims + (BigUInt.from_bytes(S2_AT_Z.bytes) * r_acc)) % q
+	fold_scalars += UInt256(r_acc).bytes
+
+	for i in urange(VK_NB_COMMITMENTS):
+		r_acc = (r_acc * r) % q
+		claims = (claims + (BigUInt.from_bytes(QCP_AT_Z[i * 32:i * 32 + 32])
+				  * r_acc)) % q
+		fold_scalars += UInt256(r_acc).bytes
+
+	digest = ec.scalar_mul_multi(EC.BLS12_381g1,
+		lin_poly_com + L_COM + R_COM + O_COM + VK_S1 + VK_S2 + VK_QCP,
+		UInt256(1).bytes + fold_scalars)
+
+	# verify the folded proof
+	r_pre = sha256(digest + BATCH_OPENING_AT_Z + fs(GRAND_PRODUCT)
+			+ OPENING_AT_Z_OMEGA + UInt256(zeta).bytes + UInt256(r).bytes)
+	r = curvemod(r_pre)
+
+	quotient = ec.scalar_mul(EC.BLS12_381g1, OPENING_AT_Z_OMEGA, r.bytes)
+	quotient = ec.add(EC.BLS12_381g1, BATCH_OPENING_AT_Z, quotient)
+	quotient = invert(quotient)
+
+	claims = (claims + (BigUInt.from_bytes(GRAND_PRODUCT_AT_Z_OMEGA.bytes)
+			  * r)) % q
+
+	# add the commitment to z, subtract the commitment to the claimed values and
+	# add the points quotient, with a single multi scalar multiplication
+	zeta_omega = (zeta * VK_OMEGA) % q
+	digest = ec.scalar_mul_multi(EC.BLS12_381g1,
+		digest + GRAND_PRODUCT + G1_SRS + BATCH_OPENING_AT_Z + OPENING_AT_Z_OMEGA,
+		UInt256(1).bytes + UInt256(r).bytes + UInt256((q - claims) % q).bytes
+		+ UInt256(zeta).bytes + UInt256((r * zeta_omega) % q).bytes)
+
+	check = ec.pairing_check(EC.BLS12_381g1, digest + quotient, G2_SRS)
+	return arc4.Bool(check)
+
+
+@subroutine
+def expmod(base: BigUInt, exponent: BigUInt, modulus: BigUInt) -> BigUInt:
+{{- if (opts).NativeModExp }}
+	"""Compute base^exponent % modulus with the AVM bmodexp opcode."""
+	return BigUInt.from_bytes(bmodexp(base.bytes, exponent.bytes, modulus.bytes))
+{{- else }}
+	"""Compute base^exponent % modulus, processing the exponent in windows of
+	   4 bits from the most significant one."""
+	# table holds base^i % modulus for i in 0..15, 32 bytes each
+	table = UInt256(1).bytes
+	power = BigUInt(1)
+	for _i in urange(15):
+		power = (power * base) % modulus
+		table += UInt256(power).bytes
+	e = UInt256(exponent).bytes
+	result = BigUInt(1)
+	started = False
+	for i in urange(64):
+		window = getbyte(e, i // 2)
+		if i % 2 == 0:
+			window = window >> 4
+		else:
+			window = window & 15
+		# squaring is skipped until the first non zero window
+		if started:
+			for _j in urange(4):
+				result = (result * result) % modulus
+		if window != 0:
+			entry = BigUInt.from_bytes(table[window * 32:window * 32 + 32])
+			result = (result * entry) % modulus
+			started = True
+	return result
+{{- end }}
+
+@subroutine
+def curvemod(x: Bytes) -> BigUInt:
+	"""Compute x % R_MOD."""
+	return BigUInt.from_bytes(x) % BigUInt(R_MOD)
+
+@subroutine
+def invert(p : Bytes) -> Bytes:
+	"""Invert a point on the curve."""
+	x = p[:48]
+	y = BigUInt.from_bytes(p[48:])
+	if y == BigUInt(0):
+		return p
+	neg_y = BigUInt(P_MOD) - y
+	return x + (bzero(48) | (neg_y).bytes)
+
+@subroutine
+def fs(p: Bytes) -> Bytes:
+	"""If p is the point at infinity, mask the first bit with 1
+	to match gnark's encoding for the fiat-shamir challenge."""
+	if p == bzero(96):
+		return setbit_bytes(p, 0, True)
+	return p
+
+@subroutine
+def ec_points(points: Bytes) -> Bytes:
+	"""Convert the points encoded as gnark does for the fiat-shamir challenge
+	to the encoding of the AVM, where the point at infinity is all zeros."""
+	res = Bytes()
+	for i in urange(points.length // G1_SIZE):
+		p = points[i * G1_SIZE:i * G1_SIZE + G1_SIZE]
+		if p == Bytes(b'\x40') + bzero(95):
+			p = bzero(96)
+		res += p
+	return res
+
+@subroutine
+def hash_fr(p: Bytes) -> BigUInt:
+	"""Hash a curve point to a field element, matching gnark's fr.Hash with
+	   domain separator 'BSB22-Plonk' (sha256-based expand_msg_xmd, 48 bytes)."""
+	dst_prime = Bytes(b'BSB22-Plonk\x0b')
+	b0 = sha256(bzero(64) + p + Bytes(b'\x00\x30\x00') + dst_prime)
+	b1 = sha256(b0 + Bytes(b'\x01') + dst_prime)
+	b2 = sha256((b0 ^ b1) + Bytes(b'\x02') + dst_prime)
+	# interpret b1 + b2[:16] as a 48-byte big-endian integer mod R_MOD
+	res = (BigUInt.from_bytes(b1)
+		   * BigUInt(340282366920938463463374607431768211456)) % BigUInt(R_MOD)
+	return (res + BigUInt.from_bytes(b2[:16])) % BigUInt(R_MOD)
+`
@@ -1,8 +1,21 @@
 package verifier
 
 import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"regexp"
 	"strings"
 	"testing"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	plonk_bls12381 "github.com/consensys/gnark/backend/plonk/bls12-381"
+	plonk_bn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/test/unsafekzg"
 )
 
 func TestInvertTemplatesPreserveXCoordinate(t *testing.T) {
@@ -57,3 +70,168 @@ func TestInvertTemplatesPreserveXCoordinate(t *testing.T) {
 		})
 	}
 }
+
+// TestTemplatesUseMultiScalarMul verifies that the verifiers compute the
+// linearization polynomial commitment, the folded digest and the pairing
+// input with ec_multi_scalar_mul, leaving a single scalar multiplication for
+// the opening quotient, whatever the number of BSB22 commitments.
+func TestTemplatesUseMultiScalarMul(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		for _, n := range []int{0, 2} {
+			vk := testVkWithCommitments(t, curve, n)
+			for _, ct := range []ContractType{LogicSig, SmartContract} {
+				code := renderVerifier(t, vk, ct)
+				if c := strings.Count(code, "ec.scalar_mul_multi("); c != 3 {
+					t.Errorf("%s %v n%d: expected 3 multi scalar multiplications, got %d",
+						curve, ct, n, c)
+				}
+				if c := strings.Count(code, "ec.scalar_mul("); c != 1 {
+					t.Errorf("%s %v n%d: expected 1 scalar multiplication, got %d",
+						curve, ct, n, c)
+				}
+				if strings.Contains(code, "add_term") {
+					t.Errorf("%s %v n%d: unexpected add_term chain", curve, ct, n)
+				}
+			}
+		}
+	}
+}
+
+// publicInputsTestCircuit has one public input for each element of P, all
+// equal to its private input Y.
+type publicInputsTestCircuit struct {
+	P []frontend.Variable `gnark:",public"`
+	Y frontend.Variable
+}
+
+func (c *publicInputsTestCircuit) Define(api frontend.API) error {
+	for _, p := range c.P {
+		api.AssertIsEqual(p, c.Y)
+	}
+	return nil
+}
+
+func testVkWithPublicInputs(t *testing.T, curve ecc.ID, nbPublicInputs int,
+) plonk.VerifyingKey {
+	t.Helper()
+	circuit := &publicInputsTestCircuit{P: make([]frontend.Variable, nbPublicInputs)}
+	ccs, err := frontend.Compile(curve.ScalarField(), scs.NewBuilder, circuit)
+	if err != nil {
+		t.Fatalf("compiling circuit: %v", err)
+	}
+	srs, lag, err := unsafekzg.NewSRS(ccs)
+	if err != nil {
+		t.Fatalf("creating srs: %v", err)
+	}
+	_, vk, err := plonk.Setup(ccs, srs, lag)
+	if err != nil {
+		t.Fatalf("plonk setup: %v", err)
+	}
+	return vk
+}
+
+// TestTemplatesUnrollPublicInputs verifies that the verifiers interpolate up
+// to maxUnrolledPublicInputs public inputs with unrolled code, using the
+// powers of omega computed at code generation, and larger numbers with loops.
+func TestTemplatesUnrollPublicInputs(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		for _, n := range []int{1, maxUnrolledPublicInputs, maxUnrolledPublicInputs + 1} {
+			vk := testVkWithPublicInputs(t, curve, n)
+			var omega string
+			switch vk := vk.(type) {
+			case *plonk_bn254.VerifyingKey:
+				omega = vk.Generator.BigInt(new(big.Int)).String()
+			case *plonk_bls12381.VerifyingKey:
+				omega = vk.Generator.BigInt(new(big.Int)).String()
+			}
+			for _, ct := range []ContractType{LogicSig, SmartContract} {
+				code := renderVerifier(t, vk, ct)
+				loops := strings.Contains(code, "urange(VK_NB_PUBLIC_INPUTS)")
+				if unrolled := n <= maxUnrolledPublicInputs; loops == unrolled {
+					t.Errorf("%s %v %d inputs: unrolled %v, found loops %v",
+						curve, ct, n, unrolled, loops)
+				}
+				if n > maxUnrolledPublicInputs {
+					continue
+				}
+				if c := strings.Count(code, "expmod(p_"); c != 1 {
+					t.Errorf("%s %v %d inputs: expected 1 inversion, got %d",
+						curve, ct, n, c)
+				}
+				if n > 1 && !strings.Contains(code, "BigUInt("+omega+")") {
+					t.Errorf("%s %v %d inputs: missing omega", curve, ct, n)
+				}
+			}
+		}
+	}
+}
+
+// moduleLevelName matches the names defined at module level in python code
+var moduleLevelName = regexp.MustCompile(`(?m)^(?:def )?([A-Za-z_]\w*)(?:\(| =|:)`)
+
+// TestSubroutineModule verifies that the Subroutine module exposes
+// verify_proof as its only unprefixed module level name.
+func TestSubroutineModule(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithCommitments(t, curve, 1)
+		code := renderVerifier(t, vk, Subroutine)
+		for _, s := range []string{"@logicsig", "py.Txn", "avm_version"} {
+			if strings.Contains(code, s) {
+				t.Errorf("%s: unexpected %s in subroutine module", curve, s)
+			}
+		}
+		if !strings.Contains(code, "def verify_proof("+
+			"proof: DynamicArray[_verifier_Bytes32], "+
+			"public_inputs: DynamicArray[_verifier_Bytes32]) -> bool:") {
+			t.Errorf("%s: missing verify_proof subroutine", curve)
+		}
+		for _, m := range moduleLevelName.FindAllStringSubmatch(code, -1) {
+			name := m[1]
+			if name != "verify_proof" && !strings.HasPrefix(name, subroutinePrefix) {
+				t.Errorf("%s: module level name %s not prefixed", curve, name)
+			}
+		}
+
+		code = renderVerifier(t, vk, Subroutine, WithAVMVersion(10))
+		if strings.Contains(code, "avm_version") {
+			t.Errorf("%s: unexpected avm_version in subroutine module", curve)
+		}
+	}
+}
+
+// TestCompanionModule verifies the checks of verified_public_inputs.
+func TestCompanionModule(t *testing.T) {
+	program := []byte{0x0a, 0x81, 0x01}
+	address := crypto.AddressFromProgram(program).String()
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		vk := testVkWithCommitments(t, curve, 1)
+		proofLength := 27
+		if curve == ecc.BLS12_381 {
+			proofLength = 37
+		}
+		nbPublicInputs, _, err := vkDimensions(vk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := renderVerifier(t, vk, Companion, WithLogicSigProgram(program))
+		for _, s := range []string{
+			"def verified_public_inputs(group_index: UInt64) -> DynamicArray[Bytes32]:",
+			"assert txn.sender == Account(\"" + address + "\")",
+			fmt.Sprintf("assert txn.app_args(1).length == 2 + %d * 32", proofLength),
+			fmt.Sprintf("assert public_inputs.length == %d", nbPublicInputs),
+		} {
+			if !strings.Contains(code, s) {
+				t.Errorf("%s: missing %s in companion module", curve, s)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := WritePythonCode(vk, Companion, &buf); err == nil {
+			t.Errorf("%s: expected error for companion without program", curve)
+		}
+		err = WritePythonCode(vk, LogicSig, &buf, WithLogicSigProgram(program))
+		if err == nil {
+			t.Errorf("%s: expected error for logicsig with program", curve)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package verifier
+
+import "fmt"
+
+// TxnField is a field of the transaction signed by a logicsig verifier that a
+// public input can be bound to with WithTxnBinding
+type TxnField int
+
+const (
+	// TxnSender binds a public input to the sender address
+	TxnSender TxnField = iota
+	// TxnReceiver binds a public input to the payment receiver address
+	TxnReceiver
+	// TxnAmount binds a public input to the payment amount
+	TxnAmount
+	// TxnAssetReceiver binds a public input to the asset receiver address
+	TxnAssetReceiver
+	// TxnAssetAmount binds a public input to the asset amount
+	TxnAssetAmount
+	// TxnXferAsset binds a public input to the id of the transferred asset
+	TxnXferAsset
+	// TxnValidFrom requires the first valid round to be at least the public
+	// input
+	TxnValidFrom
+	// TxnValidUntil requires the last valid round to be at most the public
+	// input
+	TxnValidUntil
+	// TxnGroupID binds a public input to the ID of the transaction group
+	TxnGroupID
+	// TxnCloseRemainderTo binds a public input to the address receiving the
+	// remaining algos when closing the account
+	TxnCloseRemainderTo
+	// TxnAssetCloseTo binds a public input to the address receiving the
+	// remaining asset holding when closing it
+	TxnAssetCloseTo
+	// TxnRekeyTo binds a public input to the address the account is rekeyed to
+	TxnRekeyTo
+	// TxnLease binds a public input to the lease of the transaction
+	TxnLease
+)
+
+// TxnBinding binds the public input at position PublicInput to Field, and
+// for 32-byte fields also the public input at position PublicInput+1
+type TxnBinding struct {
+	Field       TxnField
+	PublicInput int
+}
+
+// txnFieldExpr holds, for each TxnField, the python expression computing the
+// field, and the comparison the public input must satisfy. Addresses, group
+// IDs and leases are 32 bytes, more than fit in a field element, so they are
+// bound as two public inputs holding their high and low 128 bits instead of
+// being reduced modulo the curve order, which would let R and R+q match the
+// same public input. See utils.FieldElementsFromBytes.
+var txnFieldExpr = map[TxnField]struct {
+	expr  string
+	op    string
+	limbs bool
+}{
+	TxnSender:           {"py.Txn.sender.bytes", "==", true},
+	TxnReceiver:         {"py.Txn.receiver.bytes", "==", true},
+	TxnAmount:           {"BigUInt(py.Txn.amount)", "==", false},
+	TxnAssetReceiver:    {"py.Txn.asset_receiver.bytes", "==", true},
+	TxnAssetAmount:      {"BigUInt(py.Txn.asset_amount)", "==", false},
+	TxnXferAsset:        {"BigUInt(py.Txn.xfer_asset.id)", "==", false},
+	TxnValidFrom:        {"BigUInt(py.Txn.first_valid)", ">=", false},
+	TxnValidUntil:       {"BigUInt(py.Txn.last_valid)", "<=", false},
+	TxnGroupID:          {"py.Global.group_id", "==", true},
+	TxnCloseRemainderTo: {"py.Txn.close_remainder_to.bytes", "==", true},
+	TxnAssetCloseTo:     {"py.Txn.asset_close_to.bytes", "==", true},
+	TxnRekeyTo:          {"py.Txn.rekey_to.bytes", "==", true},
+	TxnLease:            {"py.Txn.lease", "==", true},
+}
+
+// publicInputs returns the positions of the public inputs bound by b
+func (b TxnBinding) publicInputs() []int {
+	if txnFieldExpr[b.Field].limbs {
+		return []int{b.PublicInput, b.PublicInput + 1}
+	}
+	return []int{b.PublicInput}
+}
+
+// templateTxnBinding returns the python statement asserting binding b. A
+// 32-byte field must equal the low 16 bytes of its two public inputs, whose
+// high 16 bytes must be zero, so that each field has a single encoding.
+func templateTxnBinding(b TxnBinding) string {
+	f := txnFieldExpr[b.Field]
+	start := b.PublicInput * 32
+	if f.limbs {
+		return fmt.Sprintf("assert bzero(16) + %[1]s[:16] + bzero(16) + %[1]s[16:] "+
+			"== public_inputs[%[2]d:%[3]d]", f.expr, start, start+64)
+	}
+	return fmt.Sprintf("assert %s %s BigUInt.from_bytes(public_inputs[%d:%d])",
+		f.expr, f.op, start, start+32)
+}
@@ -0,0 +1,212 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	plonk_bls12381 "github.com/consensys/gnark/backend/plonk/bls12-381"
+	plonk_bn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+)
+
+// PublicField is a public field of a circuit, which a smart contract verifier
+// generated with WithTypedPublicInputs takes as an argument of `verify`
+type PublicField struct {
+	// Name is the name of the argument, the snake case name of the field,
+	// prefixed with the names of the structs containing it
+	Name string
+	// Dimensions are the lengths of the nested arrays of the field, outermost
+	// first, and empty for a single value
+	Dimensions []int
+}
+
+// Size returns the number of public inputs of the field
+func (f PublicField) Size() int {
+	size := 1
+	for _, d := range f.Dimensions {
+		size *= d
+	}
+	return size
+}
+
+// ABIType returns the ABI type of the argument, e.g., uint256 or uint256[3]
+func (f PublicField) ABIType() string {
+	t := "uint256"
+	for i := len(f.Dimensions) - 1; i >= 0; i-- {
+		t += fmt.Sprintf("[%d]", f.Dimensions[i])
+	}
+	return t
+}
+
+// reservedNames are the names the arguments of the typed `verify` method
+// cannot take, the python keywords and the names the method uses, which get
+// a trailing underscore instead
+var reservedNames = map[string]bool{
+	"self": true, "proof": true, "py": true, "typing": true, "arc4": true,
+	"and": true, "as": true, "assert": true, "async": true, "await": true,
+	"break": true, "class": true, "continue": true, "def": true, "del": true,
+	"elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true,
+	"is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+	"pass": true, "raise": true, "return": true, "try": true, "while": true,
+	"with": true, "yield": true,
+}
+
+// PublicFields returns the public fields of `circuit` for `curve`, in the
+// order of the public inputs, and so of the arguments of the `verify` method
+// of a verifier generated with WithTypedPublicInputs. Fields of nested
+// structs are flattened, and slices must have the length they have in the
+// compiled circuit. Arrays of structs with public fields are not supported.
+func PublicFields(circuit frontend.Circuit, curve ecc.ID) ([]PublicField, error) {
+	tVariable := reflect.TypeOf((*frontend.Variable)(nil)).Elem()
+	s, err := schema.New(curve.ScalarField(), circuit, tVariable)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing circuit: %v", err)
+	}
+	fields, err := publicFields(s.Fields, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if names[f.Name] {
+			return nil, fmt.Errorf("two public fields named %s", f.Name)
+		}
+		names[f.Name] = true
+	}
+	return fields, nil
+}
+
+// publicFields returns the public fields among `fields`, prefixing their
+// names with `prefix`
+func publicFields(fields []schema.Field, prefix string) ([]PublicField, error) {
+	var res []PublicField
+	for _, f := range fields {
+		name := f.Name
+		if f.NameTag != "" {
+			name = f.NameTag
+		}
+		name = snakeCase(name)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if f.Type == schema.Struct {
+			sub, err := publicFields(f.SubFields, name)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, sub...)
+			continue
+		}
+		dims, public, err := fieldShape(f)
+		if err != nil {
+			return nil, fmt.Errorf("public field %s: %v", name, err)
+		}
+		if !public {
+			continue
+		}
+		if reservedNames[name] {
+			name += "_"
+		}
+		res = append(res, PublicField{name, dims})
+	}
+	return res, nil
+}
+
+// fieldShape returns the array dimensions of `f`, a value or an array, and
+// whether it is public
+func fieldShape(f schema.Field) (dims []int, public bool, err error) {
+	if f.Type == schema.Leaf {
+		return nil, f.Visibility == schema.Public, nil
+	}
+	if len(f.SubFields) == 0 {
+		return []int{f.ArraySize}, f.Visibility == schema.Public, nil
+	}
+	elem := f.SubFields[0]
+	if elem.Type == schema.Struct {
+		if hasPublic(elem) {
+			return nil, false, errors.New("arrays of structs are not supported")
+		}
+		return nil, false, nil
+	}
+	dims, public, err = fieldShape(elem)
+	return append([]int{f.ArraySize}, dims...), public, err
+}
+
+// hasPublic reports whether `f` holds public inputs
+func hasPublic(f schema.Field) bool {
+	if f.Type != schema.Struct {
+		_, public, err := fieldShape(f)
+		return public || err != nil
+	}
+	for _, sub := range f.SubFields {
+		if hasPublic(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// snakeCase converts a Go identifier to snake case, e.g., OldRoot to old_root
+// and AppID to app_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// typedPublicFields returns the public fields of the circuit of
+// WithTypedPublicInputs, checking that they are the `nbPublicInputs` public
+// inputs of `vk`
+func typedPublicFields(o *options, vk plonk.VerifyingKey, nbPublicInputs int,
+) ([]PublicField, error) {
+	var curve ecc.ID
+	switch vk.(type) {
+	case *plonk_bn254.VerifyingKey:
+		curve = ecc.BN254
+	case *plonk_bls12381.VerifyingKey:
+		curve = ecc.BLS12_381
+	default:
+		return nil, errors.New("unsupported curve")
+	}
+	fields, err := PublicFields(o.TypedPublicInputs, curve)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, f := range fields {
+		size += f.Size()
+	}
+	if size != nbPublicInputs {
+		return nil, fmt.Errorf("circuit has %d public inputs, the verifying "+
+			"key %d", size, nbPublicInputs)
+	}
+	return fields, nil
+}
+
+// templatePythonType returns the Algorand Python type of the argument of
+// public field `f`
+func templatePythonType(f PublicField) string {
+	t := "UInt256"
+	for i := len(f.Dimensions) - 1; i >= 0; i-- {
+		t = fmt.Sprintf("StaticArray[%s, typing.Literal[%d]]", t, f.Dimensions[i])
+	}
+	return t
+}
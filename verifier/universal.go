@@ -0,0 +1,310 @@
+package verifier
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"text/template"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark/backend/plonk"
+	plonk_bls12381 "github.com/consensys/gnark/backend/plonk/bls12-381"
+	plonk_bn254 "github.com/consensys/gnark/backend/plonk/bn254"
+)
+
+// maxVerifyingKeySize is the largest size in bytes of a verifying key a
+// universal verifier reads from a box, the largest byte array the AVM handles
+const maxVerifyingKeySize = 4096
+
+// WriteUniversalPythonCode generates the python code of a universal verifier
+// smart contract for `curve` and writes it to `w`. Instead of the constants of
+// one verifying key, the contract reads at runtime the verifying key the
+// caller selects among those registered by its creator, so that a single
+// contract verifies proofs for any circuit compiled for the curve.
+//
+// The creator registers a verifying key with `register_vk(vk_hash, size,
+// offset, chunk)`, writing the chunks of MarshalUniversalVerifyingKey to a box
+// named "v" followed by its UniversalVerifyingKeyHash, then calls
+// `finalize_vk(vk_hash)`, which checks that the written key has the size of
+// its number of commitments and hashes to `vk_hash`, and deletes it with
+// `delete_vk(vk_hash)`; `make_immutable` freezes the registered keys.
+// `verify(vk_hash, proof, public_inputs)` verifies a proof with the
+// finalized verifying key `vk_hash`. utils.RegisterVerifyingKeyMethodArgs and
+// utils.VerifyingKeyBoxReferences build the app calls.
+//
+// Only WithSubgroupChecks, WithNativeModExp and WithAVMVersion are supported.
+// The app account must be funded to cover the minimum balance of the boxes of
+// the registered keys, 2,500 plus 400 microalgos per byte of box name and size,
+// the size being one byte more than the key for its finalization status.
+func WriteUniversalPythonCode(curve ecc.ID, w io.Writer, opts ...Option) error {
+	o, err := universalOptions(opts)
+	if err != nil {
+		return err
+	}
+	if o.AVMVersion != 0 {
+		if err := o.require(featureBoxes); err != nil {
+			return err
+		}
+	}
+	return writeUniversal(curve, w, o, nil)
+}
+
+// NamedVerifyingKey is the verifying key of one of the circuits of a verifier
+// generated with WriteMultiPythonCode
+type NamedVerifyingKey struct {
+	// Name names the `verify_<name>` method verifying the proofs of the
+	// circuit, in lowercase letters, digits and underscores
+	Name         string
+	VerifyingKey plonk.VerifyingKey
+}
+
+// multiCircuit is a circuit of a verifier generated with WriteMultiPythonCode,
+// with its verifying key serialized by MarshalUniversalVerifyingKey as a hex
+// string
+type multiCircuit struct {
+	Name string
+	Hex  string
+}
+
+// multiNameRegexp matches the names of the circuits of WriteMultiPythonCode
+var multiNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// MaxProgramSize is the largest size in bytes of the approval and clear
+// programs of an app, using the three extra pages
+const MaxProgramSize = 4 * 2048
+
+// multiCodeSize and multiMethodSize are rough, unmeasured estimates of the
+// size in bytes of the compiled code of a verifier generated with
+// WriteMultiPythonCode, the code shared by the circuits and each
+// `verify_<name>` method besides its verifying key
+const (
+	multiCodeSize   = 2000
+	multiMethodSize = 40
+)
+
+// WriteMultiPythonCode generates the python code of a smart contract
+// verifying the proofs of several circuits compiled for the same curve, with
+// a `verify_<name>` method for each of `vks`, and writes it to `w`. The
+// methods take the proof and public inputs as exported by AlgoPlonk and share
+// the verification code, reading the verifying key of their circuit, embedded
+// as serialized by MarshalUniversalVerifyingKey, at runtime.
+//
+// Only WithSubgroupChecks, WithNativeModExp and WithAVMVersion are supported.
+// The verifier may not fit in the 8,192 bytes of an app program, which
+// utils.CheckProgramSize checks after compilation; EstimateMultiProgramSize
+// gives a rough idea of its size beforehand.
+func WriteMultiPythonCode(vks []NamedVerifyingKey, w io.Writer,
+	opts ...Option) error {
+	o, err := universalOptions(opts)
+	if err != nil {
+		return err
+	}
+	if len(vks) == 0 {
+		return errors.New("no verifying keys")
+	}
+	var curve ecc.ID
+	switch vks[0].VerifyingKey.(type) {
+	case *plonk_bn254.VerifyingKey:
+		curve = ecc.BN254
+	case *plonk_bls12381.VerifyingKey:
+		curve = ecc.BLS12_381
+	default:
+		return errors.New("unsupported curve")
+	}
+	circuits := make([]multiCircuit, len(vks))
+	names := make(map[string]bool)
+	for i, vk := range vks {
+		if !multiNameRegexp.MatchString(vk.Name) {
+			return fmt.Errorf("invalid circuit name %q", vk.Name)
+		}
+		if names[vk.Name] {
+			return fmt.Errorf("two circuits named %s", vk.Name)
+		}
+		names[vk.Name] = true
+		if reflect.TypeOf(vk.VerifyingKey) != reflect.TypeOf(vks[0].VerifyingKey) {
+			return fmt.Errorf("circuit %s is not compiled for %s", vk.Name, curve)
+		}
+		data, err := MarshalUniversalVerifyingKey(vk.VerifyingKey)
+		if err != nil {
+			return fmt.Errorf("circuit %s: %v", vk.Name, err)
+		}
+		circuits[i] = multiCircuit{vk.Name, hex.EncodeToString(data)}
+	}
+	return writeUniversal(curve, w, o, circuits)
+}
+
+// EstimateMultiProgramSize returns a rough estimate of the size in bytes of
+// the compiled programs of the verifier WriteMultiPythonCode generates for
+// `vks`, the size of the verifying keys plus unmeasured allowances for the
+// code. It is not a bound either way: only utils.CheckProgramSize, on the
+// compiled programs, tells whether the verifier fits in MaxProgramSize.
+func EstimateMultiProgramSize(vks []NamedVerifyingKey) (int, error) {
+	size := multiCodeSize
+	for _, vk := range vks {
+		data, err := MarshalUniversalVerifyingKey(vk.VerifyingKey)
+		if err != nil {
+			return 0, fmt.Errorf("circuit %s: %v", vk.Name, err)
+		}
+		size += multiMethodSize + len(data)
+	}
+	return size, nil
+}
+
+// universalOptions returns the options of a universal verifier or a verifier
+// generated with WriteMultiPythonCode, which only support the options not
+// depending on the verifying key
+func universalOptions(opts []Option) (*options, error) {
+	o := newOptions(opts)
+	if err := o.resolve(SmartContract); err != nil {
+		return nil, err
+	}
+	if o.Resumable || o.OpUp || o.PostVerifyHook != "" || o.Nullifier ||
+		o.StateRoot || o.DomainSeparation || o.HashedPublicInputs > 0 ||
+		o.BoxInputs || o.FailureReasons || o.VerifiedEvent ||
+		o.TypedPublicInputs != nil {
+		return nil, errors.New("universal verifiers only support subgroup " +
+			"checks, native modexp and AVM version options")
+	}
+	return o, nil
+}
+
+// writeUniversal writes the python code of a universal verifier for `curve`,
+// or, if `circuits` are given, of a verifier with a method for each of them
+func writeUniversal(curve ecc.ID, w io.Writer, o *options,
+	circuits []multiCircuit) error {
+	var templ string
+	switch curve {
+	case ecc.BN254:
+		templ = tmplUniversalVerifierBn254
+	case ecc.BLS12_381:
+		templ = tmplUniversalVerifierBls12_381
+	default:
+		return errors.New("unsupported curve")
+	}
+	funcMap := template.FuncMap{
+		"contractName": func() string {
+			return DefaultFileName
+		},
+		"opts": func() *options {
+			return o
+		},
+	}
+	t, err := template.New("t").Funcs(funcMap).Parse(templ)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, circuits)
+}
+
+// MarshalUniversalVerifyingKey serializes `vk` into the layout universal
+// verifiers generated with WriteUniversalPythonCode read from box storage:
+//
+//   - the number of public inputs, of BSB22 commitments and the domain size,
+//     as 8-byte big-endian integers
+//   - the inverse of the domain size, the domain generator and the coset
+//     shift, as 32-byte field elements
+//   - the commitments S1, S2, S3, Ql, Qr, Qm, Qo and Qk, the G1 point of the
+//     KZG setup and its two G2 points
+//   - the commitments Qcp of the BSB22 commitments, followed by their
+//     constraint indexes as 8-byte big-endian integers
+//
+// G1 points are serialized as gnark does for the Fiat-Shamir challenges, and
+// the coordinates of the G2 points in the order the AVM expects.
+func MarshalUniversalVerifyingKey(vk plonk.VerifyingKey) ([]byte, error) {
+	var res []byte
+	switch vk := vk.(type) {
+	case *plonk_bn254.VerifyingKey:
+		res = universalKeyHeader(vk.NbPublicVariables,
+			len(vk.CommitmentConstraintIndexes), vk.Size)
+		for _, x := range [][32]byte{vk.SizeInv.Bytes(), vk.Generator.Bytes(),
+			vk.CosetShift.Bytes()} {
+			res = append(res, x[:]...)
+		}
+		points := []bn254.G1Affine{vk.S[0], vk.S[1], vk.S[2], vk.Ql, vk.Qr,
+			vk.Qm, vk.Qo, vk.Qk, vk.Kzg.G1}
+		for _, p := range points {
+			b := p.RawBytes()
+			res = append(res, b[:]...)
+		}
+		for _, p := range vk.Kzg.G2 {
+			for _, x := range [][32]byte{p.X.A0.Bytes(), p.X.A1.Bytes(),
+				p.Y.A0.Bytes(), p.Y.A1.Bytes()} {
+				res = append(res, x[:]...)
+			}
+		}
+		for _, p := range vk.Qcp {
+			b := p.RawBytes()
+			res = append(res, b[:]...)
+		}
+		res = universalKeyIndexes(res, vk.CommitmentConstraintIndexes)
+	case *plonk_bls12381.VerifyingKey:
+		res = universalKeyHeader(vk.NbPublicVariables,
+			len(vk.CommitmentConstraintIndexes), vk.Size)
+		for _, x := range [][32]byte{vk.SizeInv.Bytes(), vk.Generator.Bytes(),
+			vk.CosetShift.Bytes()} {
+			res = append(res, x[:]...)
+		}
+		points := []bls12381.G1Affine{vk.S[0], vk.S[1], vk.S[2], vk.Ql, vk.Qr,
+			vk.Qm, vk.Qo, vk.Qk, vk.Kzg.G1}
+		for _, p := range points {
+			b := p.RawBytes()
+			res = append(res, b[:]...)
+		}
+		for _, p := range vk.Kzg.G2 {
+			for _, x := range [][48]byte{p.X.A0.Bytes(), p.X.A1.Bytes(),
+				p.Y.A0.Bytes(), p.Y.A1.Bytes()} {
+				res = append(res, x[:]...)
+			}
+		}
+		for _, p := range vk.Qcp {
+			b := p.RawBytes()
+			res = append(res, b[:]...)
+		}
+		res = universalKeyIndexes(res, vk.CommitmentConstraintIndexes)
+	default:
+		return nil, errors.New("unsupported curve")
+	}
+	if len(res) > maxVerifyingKeySize {
+		return nil, fmt.Errorf("verifying key of %d bytes exceeds the %d bytes "+
+			"a universal verifier can read from a box", len(res),
+			maxVerifyingKeySize)
+	}
+	return res, nil
+}
+
+// UniversalVerifyingKeyHash returns the SHA-256 hash of `vk` serialized by
+// MarshalUniversalVerifyingKey, which identifies the verifying key in the
+// boxes of a universal verifier generated with WriteUniversalPythonCode. The
+// verifier checks that the registered key hashes to it before accepting it.
+func UniversalVerifyingKeyHash(vk plonk.VerifyingKey) ([]byte, error) {
+	data, err := MarshalUniversalVerifyingKey(vk)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(data)
+	return h[:], nil
+}
+
+// universalKeyHeader returns the integers starting the layout of
+// MarshalUniversalVerifyingKey
+func universalKeyHeader(nbPublicInputs uint64, nbCommitments int,
+	domainSize uint64) []byte {
+	res := binary.BigEndian.AppendUint64(nil, nbPublicInputs)
+	res = binary.BigEndian.AppendUint64(res, uint64(nbCommitments))
+	return binary.BigEndian.AppendUint64(res, domainSize)
+}
+
+// universalKeyIndexes appends the commitment constraint indexes to `res`
+func universalKeyIndexes(res []byte, indexes []uint64) []byte {
+	for _, i := range indexes {
+		res = binary.BigEndian.AppendUint64(res, i)
+	}
+	return res
+}
@@ -0,0 +1,200 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+)
+
+// TestUniversalVerifier verifies that universal verifiers read the verifying
+// key from the box of the hash they are called with, once finalized, support
+// only the options that do not depend on the verifying key, and that
+// MarshalUniversalVerifyingKey writes the layout the templates read.
+func TestUniversalVerifier(t *testing.T) {
+	groups := map[ecc.ID]string{ecc.BN254: "BN254g1", ecc.BLS12_381: "BLS12_381g1"}
+	for curve, group := range groups {
+		t.Run(curve.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteUniversalPythonCode(curve, &buf); err != nil {
+				t.Fatal(err)
+			}
+			code := buf.String()
+			for _, s := range []string{
+				"def register_vk(self, vk_hash: Bytes32",
+				"def finalize_vk(self, vk_hash: Bytes32)",
+				"assert sha256(vk.extract(0, size)) == vk_hash.bytes",
+				"assert vk.extract(size, 1) == VK_FINALIZED",
+				"def delete_vk(self, vk_hash: Bytes32)",
+				"return verify_proof(vk.extract(0, size), proof, public_inputs)",
+				"ec.pairing_check(EC." + group + ", digest + quotient, G2_SRS)",
+			} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+			if strings.Contains(code, "subgroup_check") ||
+				strings.Contains(code, "avm_version") {
+				t.Errorf("unexpected option in default universal verifier")
+			}
+
+			buf.Reset()
+			err := WriteUniversalPythonCode(curve, &buf, WithSubgroupChecks(),
+				WithNativeModExp(), WithAVMVersion(12))
+			if err != nil {
+				t.Fatal(err)
+			}
+			code = buf.String()
+			for _, s := range []string{"subgroup_check", "bmodexp",
+				"avm_version=12"} {
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+			}
+
+			for _, opt := range []Option{WithBoxInputs(), WithNullifier(0),
+				WithVerifiedEvent(false), WithFailureReasons(),
+				WithResumableVerification()} {
+				if err := WriteUniversalPythonCode(curve, &buf, opt); err == nil {
+					t.Errorf("expected error for unsupported option")
+				}
+			}
+
+			g1, g2 := 64, 128
+			if curve == ecc.BLS12_381 {
+				g1, g2 = 96, 192
+			}
+			for _, nbCommitments := range []int{0, 2} {
+				vk := testVkWithCommitments(t, curve, nbCommitments)
+				data, err := MarshalUniversalVerifyingKey(vk)
+				if err != nil {
+					t.Fatal(err)
+				}
+				size := 120 + 9*g1 + 2*g2 + nbCommitments*(g1+8)
+				if len(data) != size {
+					t.Fatalf("got %d bytes, want %d", len(data), size)
+				}
+				header := fmt.Sprint(binary.BigEndian.Uint64(data[0:8]),
+					binary.BigEndian.Uint64(data[8:16]))
+				if header != fmt.Sprint(1, nbCommitments) {
+					t.Errorf("got public inputs and commitments %s", header)
+				}
+				h, err := UniversalVerifyingKeyHash(vk)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := sha256.Sum256(data); !bytes.Equal(h, want[:]) {
+					t.Errorf("verifying key hash is not the hash of its layout")
+				}
+			}
+		})
+	}
+	var buf bytes.Buffer
+	if err := WriteUniversalPythonCode(ecc.BW6_761, &buf); err == nil {
+		t.Errorf("expected error for unsupported curve")
+	}
+}
+
+// TestMultiVerifier verifies that WriteMultiPythonCode generates a verify
+// method for each circuit sharing the verification code, and rejects invalid
+// or duplicate names, mixed curves and verifying keys exceeding the program
+// size.
+func TestMultiVerifier(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			vks := []NamedVerifyingKey{
+				{"deposit", testVkWithCommitments(t, curve, 0)},
+				{"transfer", testVkWithCommitments(t, curve, 1)},
+				{"withdraw", testVkWithCommitments(t, curve, 2)},
+			}
+			var buf bytes.Buffer
+			if err := WriteMultiPythonCode(vks, &buf); err != nil {
+				t.Fatal(err)
+			}
+			code := buf.String()
+			for _, vk := range vks {
+				data, err := MarshalUniversalVerifyingKey(vk.VerifyingKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s := fmt.Sprintf("def verify_%s(self,", vk.Name)
+				if !strings.Contains(code, s) {
+					t.Errorf("missing %s in generated code", s)
+				}
+				s = fmt.Sprintf("verify_proof(Bytes.from_hex(\"%x\"), proof, "+
+					"public_inputs)", data)
+				if !strings.Contains(code, s) {
+					t.Errorf("missing verifying key of %s in generated code",
+						vk.Name)
+				}
+			}
+			for _, s := range []string{"def verify_proof(", "def expmod(",
+				"def hash_fr("} {
+				if n := strings.Count(code, s); n != 1 {
+					t.Errorf("got %d %s in generated code, want 1", n, s)
+				}
+			}
+			if strings.Contains(code, "register_vk") {
+				t.Errorf("unexpected verifying key registration")
+			}
+
+			other := ecc.BLS12_381
+			if curve == ecc.BLS12_381 {
+				other = ecc.BN254
+			}
+			for _, invalid := range [][]NamedVerifyingKey{
+				nil,
+				{vks[0], {"deposit", vks[1].VerifyingKey}},
+				{{"Deposit", vks[0].VerifyingKey}},
+				{{"verify-deposit", vks[0].VerifyingKey}},
+				{vks[0], {"other", testVkWithCommitments(t, other, 0)}},
+			} {
+				if err := WriteMultiPythonCode(invalid, &buf); err == nil {
+					t.Errorf("expected error for %d verifying keys", len(invalid))
+				}
+			}
+			if err := WriteMultiPythonCode(vks, &buf, WithNullifier(0)); err == nil {
+				t.Errorf("expected error for unsupported option")
+			}
+		})
+	}
+}
+
+// TestEstimateMultiProgramSize verifies that EstimateMultiProgramSize grows
+// by the size of each serialized verifying key plus the per-method allowance,
+// and that WriteMultiPythonCode leaves checking the size of the program to
+// utils.CheckProgramSize, writing verifiers estimated above MaxProgramSize.
+func TestEstimateMultiProgramSize(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+		t.Run(curve.String(), func(t *testing.T) {
+			vk := testVkWithCommitments(t, curve, 0)
+			data, err := MarshalUniversalVerifyingKey(vk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var vks []NamedVerifyingKey
+			for i := 0; ; i++ {
+				size, err := EstimateMultiProgramSize(vks)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := multiCodeSize + i*(multiMethodSize+len(data)); size != want {
+					t.Fatalf("%d circuits estimated at %d bytes, want %d", i, size,
+						want)
+				}
+				if size > MaxProgramSize {
+					break
+				}
+				vks = append(vks, NamedVerifyingKey{fmt.Sprintf("c%d", i), vk})
+			}
+			var buf bytes.Buffer
+			if err := WriteMultiPythonCode(vks, &buf); err != nil {
+				t.Errorf("unexpected error for %d circuits: %v", len(vks), err)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"strings"
 	"text/template"
 
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
@@ -25,89 +26,250 @@ type ContractType int
 const (
 	LogicSig ContractType = iota
 	SmartContract
+	// Subroutine is a module exposing a `verify_proof` subroutine that any
+	// Algorand Python contract can import to verify proofs inline
+	Subroutine
+	// Companion is a module exposing a `verified_public_inputs` subroutine
+	// that Algorand Python contracts can import to trust a logicsig verifier
+	// signing another transaction of their group
+	Companion
 )
 
+// subroutinePrefix prefixes the module level names of a Subroutine module
+// other than `verify_proof`, so that they do not clash with the names of the
+// contracts importing it
+const subroutinePrefix = "_verifier_"
+
 // DefaultFileName is the prefix for filenames created by PuyaPy when compiling
 // the logicsig or smart contrct verifiers (e.g., Verifier.approval.teal)
 const DefaultFileName = "Verifier"
 
-// WritePythonCode generates the python code for a verifier logicsig or smart contract
-// (as specified by outputType), based on the provided verifying key and writes it
-// to  provided writer. The python code can be compiled with the PuyaPy compiler
-func WritePythonCode(vk plonk.VerifyingKey, outputType ContractType, w io.Writer) error {
-	var funcMap template.FuncMap
+// WritePythonCode generates the python code for a verifier logicsig, smart contract,
+// subroutine or companion module (as specified by outputType), based on the provided verifying
+// key and writes it to  provided writer. The python code can be compiled with the PuyaPy compiler.
+// Options can be passed to customize the generated verifier.
+func WritePythonCode(vk plonk.VerifyingKey, outputType ContractType, w io.Writer,
+	opts ...Option) error {
+	o := newOptions(opts)
+	if err := o.resolve(outputType); err != nil {
+		return err
+	}
+	nbPublicInputs, _, err := vkDimensions(vk)
+	if err != nil {
+		return err
+	}
+	inputs := "public_inputs"
+	if o.HashedPublicInputs > 0 {
+		if nbPublicInputs != 1 {
+			return fmt.Errorf("hashed public inputs require a circuit with one "+
+				"public input, got %d", nbPublicInputs)
+		}
+		nbPublicInputs = o.HashedPublicInputs
+		inputs = "digest"
+	}
+	type publicInput struct {
+		name  string
+		index int
+	}
+	var indexes []publicInput
+	if o.Nullifier {
+		indexes = append(indexes, publicInput{"nullifier", o.NullifierIndex})
+	}
+	if o.StateRoot {
+		indexes = append(indexes, publicInput{"old state root", o.OldRootIndex},
+			publicInput{"new state root", o.NewRootIndex})
+	}
+	if o.DomainSeparation {
+		indexes = append(indexes, publicInput{"genesis hash", o.GenesisHashIndex},
+			publicInput{"genesis hash", o.GenesisHashIndex + 1},
+			publicInput{"app ID", o.AppIDIndex})
+	}
+	for _, b := range o.TxnBindings {
+		for _, index := range b.publicInputs() {
+			indexes = append(indexes, publicInput{"transaction binding", index})
+		}
+	}
+	for _, p := range indexes {
+		if p.index < 0 || p.index >= nbPublicInputs {
+			return fmt.Errorf("%s index %d out of range for %d public inputs",
+				p.name, p.index, nbPublicInputs)
+		}
+	}
+	if outputType == Companion {
+		return writeCompanion(vk, nbPublicInputs, o, w)
+	}
+	uploadDeposit := 0
+	if o.BoxInputs {
+		proofLength, err := proofLength(vk)
+		if err != nil {
+			return err
+		}
+		size := 32 * (proofLength + nbPublicInputs)
+		if size > maxUploadSize {
+			return fmt.Errorf("box inputs of %d bytes exceed the %d bytes a "+
+				"verifier can read from a box", size, maxUploadSize)
+		}
+		uploadDeposit = uploadBoxDeposit(size)
+	}
+	vkHash := ""
+	if o.VerifiedEvent {
+		if err := checkLogSize(o, nbPublicInputs); err != nil {
+			return err
+		}
+		h, err := VerifyingKeyHash(vk)
+		if err != nil {
+			return err
+		}
+		vkHash = hex.EncodeToString(h)
+	}
+	var typedInputs []PublicField
+	if o.TypedPublicInputs != nil {
+		if typedInputs, err = typedPublicFields(o, vk, nbPublicInputs); err != nil {
+			return err
+		}
+	}
+	ns := ""
+	if outputType == Subroutine {
+		ns = subroutinePrefix
+	}
+	opUpBudget := 0
+	if o.OpUp {
+		if opUpBudget, err = EstimateOpcodeBudget(vk, opts...); err != nil {
+			return err
+		}
+		if o.BoxInputs {
+			// `verify_uploaded` spends this part of the estimate before
+			// calling `verify`, which raises the budget for the rest
+			opUpBudget -= budgetBoxInputs
+		}
+	}
+	funcMap := template.FuncMap{
+		"inc": func(i any) int {
+			return toInt(i) + 1
+		},
+		"add":      templateAdd,
+		"sub":      templateSub,
+		"mul":      templateMul,
+		"unrolled": templateUnrolled,
+		"contractName": func() string {
+			return DefaultFileName
+		},
+		"opts": func() *options {
+			return o
+		},
+		"opUpBudget": func() int {
+			return opUpBudget
+		},
+		"uploadDeposit": func() int {
+			return uploadDeposit
+		},
+		"inputs": func() string {
+			return inputs
+		},
+		"nbInputs": func() int {
+			return nbPublicInputs
+		},
+		"indent":         templateIndent,
+		"txnBinding":     templateTxnBinding,
+		"failureReasons": templateFailureReasons,
+		"reject": func(name string) (string, error) {
+			return templateReject(o, outputType, name)
+		},
+		"because": func(name string) (string, error) {
+			return templateBecause(o, name)
+		},
+		"verifiedEvent": func() string {
+			if o.VerifiedEventPublicInputs {
+				return VerifiedEventWithPublicInputsSignature
+			}
+			return VerifiedEventSignature
+		},
+		"vkHash": func() string {
+			return vkHash
+		},
+		"typedInputs": func() []PublicField {
+			return typedInputs
+		},
+		"pyType": templatePythonType,
+		"embedded": func() bool {
+			return outputType == Subroutine
+		},
+		"ns": func() string {
+			return ns
+		},
+	}
 	var templ string
 	switch vk.(type) {
 
 	case *plonk_bn254.VerifyingKey:
-		funcMap = template.FuncMap{
-			"inc": func(i int) int {
-				return i + 1
-			},
-			"add": templateAdd,
-			"mul": templateMul,
-			"contractName": func() string {
-				return DefaultFileName
-			},
-			"frstr": func(x fr_bn254.Element) string {
-				bv := new(big.Int)
-				x.BigInt(bv)
-				return bv.String()
-			},
-			"fpstr": func(x fp_bn254.Element) string {
-				bv := new(big.Int)
-				x.BigInt(bv)
-				return bv.String()
-			},
-			"hex": func(p bn254.G1Affine) string {
-				b := p.RawBytes()
-				return hex.EncodeToString(b[:])
-			},
-		}
-		if outputType == LogicSig {
+		funcMap["frstr"] = func(x fr_bn254.Element) string {
+			bv := new(big.Int)
+			x.BigInt(bv)
+			return bv.String()
+		}
+		funcMap["frpow"] = func(x fr_bn254.Element, e any) string {
+			var y fr_bn254.Element
+			y.Exp(x, big.NewInt(int64(toInt(e))))
+			bv := new(big.Int)
+			y.BigInt(bv)
+			return bv.String()
+		}
+		funcMap["fpstr"] = func(x fp_bn254.Element) string {
+			bv := new(big.Int)
+			x.BigInt(bv)
+			return bv.String()
+		}
+		funcMap["hex"] = func(p bn254.G1Affine) string {
+			b := p.RawBytes()
+			return hex.EncodeToString(b[:])
+		}
+		switch outputType {
+		case LogicSig, Subroutine:
 			templ = tmplLogicSigVerifierBn254
-		} else {
+		case SmartContract:
 			templ = tmplSmartContractVerifierBn254
+		default:
+			return errors.New("unsupported contract type")
 		}
 
 	case *plonk_bls12381.VerifyingKey:
-		funcMap = template.FuncMap{
-			"inc": func(i int) int {
-				return i + 1
-			},
-			"add": templateAdd,
-			"mul": templateMul,
-			"contractName": func() string {
-				return DefaultFileName
-			},
-			"frstr": func(x fr_bls12381.Element) string {
-				bv := new(big.Int)
-				x.BigInt(bv)
-				return bv.String()
-			},
-			"fpstr": func(x fp_bls12381.Element) string {
-				bv := new(big.Int)
-				x.BigInt(bv)
-				return bv.String()
-			},
-			"hex": func(p bls12381.G1Affine) string {
-				b := p.RawBytes()
-				if p.IsInfinity() {
-					// the first byte is 0x40 to indicate infinity,
-					// but we want it set to 0x00 for the verifier
-					b[0] = 0x00
-				}
-				return hex.EncodeToString(b[:])
-			},
-			"hexEncoded": func(p bls12381.G1Affine) string {
-				b := p.RawBytes()
-				return hex.EncodeToString(b[:])
-			},
-		}
-		if outputType == LogicSig {
+		funcMap["frstr"] = func(x fr_bls12381.Element) string {
+			bv := new(big.Int)
+			x.BigInt(bv)
+			return bv.String()
+		}
+		funcMap["frpow"] = func(x fr_bls12381.Element, e any) string {
+			var y fr_bls12381.Element
+			y.Exp(x, big.NewInt(int64(toInt(e))))
+			bv := new(big.Int)
+			y.BigInt(bv)
+			return bv.String()
+		}
+		funcMap["fpstr"] = func(x fp_bls12381.Element) string {
+			bv := new(big.Int)
+			x.BigInt(bv)
+			return bv.String()
+		}
+		funcMap["hex"] = func(p bls12381.G1Affine) string {
+			b := p.RawBytes()
+			if p.IsInfinity() {
+				// the first byte is 0x40 to indicate infinity,
+				// but we want it set to 0x00 for the verifier
+				b[0] = 0x00
+			}
+			return hex.EncodeToString(b[:])
+		}
+		funcMap["hexEncoded"] = func(p bls12381.G1Affine) string {
+			b := p.RawBytes()
+			return hex.EncodeToString(b[:])
+		}
+		switch outputType {
+		case LogicSig, Subroutine:
 			templ = tmplLogicSigVerifierBls12_381
-		} else {
+		case SmartContract:
 			templ = tmplSmartContractVerifierBls12_381
+		default:
+			return errors.New("unsupported contract type")
 		}
 
 	default:
@@ -121,17 +283,121 @@ func WritePythonCode(vk plonk.VerifyingKey, outputType ContractType, w io.Writer
 	return t.Execute(w, vk)
 }
 
-// templateAdd and templateMul provide integer arithmetic to the templates,
-// e.g. to compute proof offsets for the BSB22 commitment data whose position
-// depends on the number of commitments.
+// vkDimensions returns the number of public inputs and of BSB22 commitments
+// of the circuit of `vk`
+func vkDimensions(vk plonk.VerifyingKey) (nbPublicInputs, nbCommitments int,
+	err error) {
+	switch vk := vk.(type) {
+	case *plonk_bn254.VerifyingKey:
+		return int(vk.NbPublicVariables), len(vk.CommitmentConstraintIndexes), nil
+	case *plonk_bls12381.VerifyingKey:
+		return int(vk.NbPublicVariables), len(vk.CommitmentConstraintIndexes), nil
+	default:
+		return 0, 0, errors.New("unsupported curve")
+	}
+}
+
+// proofLength returns the number of 32-byte values of the proofs for `vk`
+func proofLength(vk plonk.VerifyingKey) (int, error) {
+	_, nbCommitments, err := vkDimensions(vk)
+	if err != nil {
+		return 0, err
+	}
+	switch vk.(type) {
+	case *plonk_bn254.VerifyingKey:
+		return 24 + 3*nbCommitments, nil
+	default:
+		return 33 + 4*nbCommitments, nil
+	}
+}
+
+// maxUploadSize is the largest size in bytes of the proof and public inputs
+// a verifier generated with WithBoxInputs reads from a box, the largest
+// byte array the AVM handles
+const maxUploadSize = 4096
+
+// uploadBoxDeposit returns the deposit in microalgos that the `start_upload`
+// method of a verifier generated with WithBoxInputs takes for proofs and
+// public inputs of `size` bytes: the minimum balance of the upload box, 2,500
+// plus 400 microalgos per byte of its 33-byte name and its size
+func uploadBoxDeposit(size int) int {
+	return 2_500 + 400*(33+size)
+}
+
+// maxUnrolledPublicInputs is the largest number of public inputs for which
+// the verifiers interpolate the public inputs with unrolled code instead of
+// loops over arrays
+const maxUnrolledPublicInputs = 4
+
+// templateAdd, templateSub and templateMul provide integer arithmetic to the
+// templates, e.g. to compute proof offsets for the BSB22 commitment data whose
+// position depends on the number of commitments.
 func templateAdd(a, b any) int {
 	return toInt(a) + toInt(b)
 }
 
+func templateSub(a, b any) int {
+	return toInt(a) - toInt(b)
+}
+
 func templateMul(a, b any) int {
 	return toInt(a) * toInt(b)
 }
 
+// templateUnrolled reports whether the templates should unroll the code
+// handling nbPublicInputs public inputs
+func templateUnrolled(nbPublicInputs any) bool {
+	return toInt(nbPublicInputs) <= maxUnrolledPublicInputs
+}
+
+// templateIndent returns the python code `code` indented by `level` tabs,
+// after removing the leading whitespace common to its lines and the blank
+// lines at its start and end. The remaining indentation is converted to tabs,
+// one for each tab and for each indentation unit of spaces, the shortest
+// space indentation of `code`, so that code indented with spaces fits the
+// tab-indented templates
+func templateIndent(level int, code string) string {
+	lines := strings.Split(strings.Trim(code, "\n"), "\n")
+	common, found := "", false
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		lines[i] = line
+		if line == "" {
+			continue
+		}
+		indentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			common, found = indentation, true
+		}
+		for !strings.HasPrefix(indentation, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	unit := 0
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, common)
+		indentation := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+		if n := strings.Count(indentation, " "); n > 0 && (unit == 0 || n < unit) {
+			unit = n
+		}
+	}
+	prefix := strings.Repeat("\t", level)
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		code := strings.TrimLeft(line, " \t")
+		indentation := line[:len(line)-len(code)]
+		tabs, spaces := strings.Count(indentation, "\t"), strings.Count(indentation, " ")
+		if unit > 0 {
+			tabs, spaces = tabs+spaces/unit, spaces%unit
+		}
+		lines[i] = prefix + strings.Repeat("\t", tabs) + strings.Repeat(" ", spaces) +
+			code
+	}
+	return strings.Join(lines, "\n")
+}
+
 func toInt(v any) int {
 	switch n := v.(type) {
 	case int: